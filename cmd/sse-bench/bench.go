@@ -0,0 +1,311 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/99nil/gopkg/sse"
+)
+
+// Config defines the parameters of a benchmark run.
+type Config struct {
+	URL     string
+	Header  http.Header
+	Streams int
+	// Duration is the total time of the run, 0 means until the context is done.
+	Duration time.Duration
+	// Event is the name of the event to measure, other events are ignored.
+	Event string
+	// TimestampField is the json field in the event data which holds the server timestamp.
+	// Numeric timestamps are read in TimestampUnit, string timestamps in RFC3339.
+	TimestampField string
+	TimestampUnit  time.Duration
+	// ReconnectDelay is used when the server does not specify a retry interval, 0 means MinReconnectDelay.
+	// It must not be shorter than MinReconnectDelay, which also bounds the retry interval of the server.
+	ReconnectDelay time.Duration
+}
+
+// MinReconnectDelay is the shortest wait between the reconnects of a stream.
+const MinReconnectDelay = 10 * time.Millisecond
+
+// Result is the summary of a benchmark run.
+type Result struct {
+	Streams  int
+	Elapsed  time.Duration
+	Events   int64
+	Invalid  int64
+	Errors   int64
+	Connects int64
+	// Reconnects counts the established connections of the streams after their first one.
+	Reconnects int64
+	Failures   int64
+	Latencies  []time.Duration
+}
+
+// Throughput returns the measured events per second over all streams.
+func (r *Result) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Events) / r.Elapsed.Seconds()
+}
+
+// Percentile returns the latency at the p-th percentile using the nearest-rank method.
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p/100*float64(len(r.Latencies)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(r.Latencies) {
+		rank = len(r.Latencies) - 1
+	}
+	return r.Latencies[rank]
+}
+
+// Mean returns the average latency.
+func (r *Result) Mean() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, v := range r.Latencies {
+		sum += v
+	}
+	return sum / time.Duration(len(r.Latencies))
+}
+
+// Run opens the configured number of streams against cfg.URL and
+// measures the latency of every received event until the duration elapses.
+func Run(ctx context.Context, client *http.Client, cfg *Config) (*Result, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, errors.New("url must be defined")
+	}
+	if cfg.Streams <= 0 {
+		return nil, errors.New("streams must be greater than 0")
+	}
+	if cfg.ReconnectDelay != 0 && cfg.ReconnectDelay < MinReconnectDelay {
+		return nil, fmt.Errorf("reconnect delay must be at least %v", MinReconnectDelay)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	b := &bench{client: client, cfg: cfg}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Streams; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.stream(ctx)
+		}()
+	}
+	wg.Wait()
+
+	result := &Result{
+		Streams:    cfg.Streams,
+		Elapsed:    time.Since(start),
+		Events:     b.events.Load(),
+		Invalid:    b.invalid.Load(),
+		Errors:     b.errors.Load(),
+		Connects:   b.connects.Load(),
+		Reconnects: b.reconnects.Load(),
+		Failures:   b.failures.Load(),
+		Latencies:  b.latencies,
+	}
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result, nil
+}
+
+type bench struct {
+	client *http.Client
+	cfg    *Config
+
+	mu        sync.Mutex
+	latencies []time.Duration
+
+	events     atomic.Int64
+	invalid    atomic.Int64
+	errors     atomic.Int64
+	connects   atomic.Int64
+	reconnects atomic.Int64
+	failures   atomic.Int64
+}
+
+func (b *bench) record(d time.Duration) {
+	b.events.Add(1)
+	b.mu.Lock()
+	b.latencies = append(b.latencies, d)
+	b.mu.Unlock()
+}
+
+func (b *bench) stream(ctx context.Context) {
+	var (
+		lastID    string
+		connected bool
+	)
+	for {
+		retry, ok := b.consume(ctx, &lastID)
+		if ok {
+			// Only the established connections after the first one are reconnects.
+			if connected {
+				b.reconnects.Add(1)
+			}
+			connected = true
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		if retry <= 0 {
+			retry = b.cfg.ReconnectDelay
+		}
+		if retry < MinReconnectDelay {
+			retry = MinReconnectDelay
+		}
+		timer := time.NewTimer(retry)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// consume reads a single connection until it ends.
+// It returns the retry interval sent by the server and whether the connection was established.
+func (b *bench) consume(ctx context.Context, lastID *string) (time.Duration, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.cfg.URL, nil)
+	if err != nil {
+		b.failures.Add(1)
+		return 0, false
+	}
+	for k, vs := range b.cfg.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if *lastID != "" {
+		req.Header.Set("Last-Event-ID", *lastID)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.failures.Add(1)
+		}
+		return 0, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b.failures.Add(1)
+		return 0, false
+	}
+	b.connects.Add(1)
+
+	var retry time.Duration
+	parser := sse.NewParser(resp.Body)
+	for {
+		message, err := parser.Read()
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				b.errors.Add(1)
+			}
+			return retry, true
+		}
+		if message.Retry > 0 {
+			retry = message.Retry
+		}
+		if message.ID != "" {
+			*lastID = message.ID
+		}
+
+		event := message.Event
+		if event == "" {
+			event = sse.EventMessage
+		}
+		if event == sse.EventError {
+			if message.IsClose() {
+				return retry, true
+			}
+			b.errors.Add(1)
+			continue
+		}
+		if event != b.cfg.Event || message.Data == "" {
+			continue
+		}
+
+		ts, err := b.timestamp([]byte(message.Data))
+		if err != nil {
+			b.invalid.Add(1)
+			continue
+		}
+		b.record(time.Since(ts))
+	}
+}
+
+func (b *bench) timestamp(data []byte) (time.Time, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return time.Time{}, err
+	}
+	raw, ok := fields[b.cfg.TimestampField]
+	if !ok {
+		return time.Time{}, fmt.Errorf("field %s not found", b.cfg.TimestampField)
+	}
+
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return time.Parse(time.RFC3339Nano, str)
+	}
+
+	unit := b.cfg.TimestampUnit
+	if unit <= 0 {
+		unit = time.Millisecond
+	}
+	if n, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+		return time.Unix(0, 0).Add(time.Duration(n) * unit), nil
+	}
+	f, err := strconv.ParseFloat(string(raw), 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, int64(f*float64(unit))), nil
+}
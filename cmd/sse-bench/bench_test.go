@@ -0,0 +1,209 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99nil/gopkg/sse"
+)
+
+func TestRun(t *testing.T) {
+	const (
+		streams        = 3
+		eventsPerConn  = 5
+		invalidPerConn = 1
+		duration       = 500 * time.Millisecond
+	)
+
+	var (
+		requests    atomic.Int64
+		lastEventID atomic.Int64
+	)
+	handler := sse.Handler(func(ctx context.Context, s *sse.Sender) error {
+		for i := 0; i < eventsPerConn; i++ {
+			s.Send(&sse.Message{
+				ID:    strconv.Itoa(i),
+				Event: sse.EventMessage,
+				Data:  fmt.Sprintf(`{"ts": %q}`, time.Now().Format(time.RFC3339Nano)),
+			})
+		}
+		s.Send(&sse.Message{Event: sse.EventMessage, Data: `{"other": 1}`})
+		return nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Last-Event-ID") != "" {
+			lastEventID.Add(1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	result, err := Run(context.Background(), srv.Client(), &Config{
+		URL:            srv.URL,
+		Streams:        streams,
+		Duration:       duration,
+		Event:          sse.EventMessage,
+		TimestampField: "ts",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Failures != 0 || result.Errors != 0 {
+		t.Fatalf("unexpected failures %d and errors %d", result.Failures, result.Errors)
+	}
+	if result.Connects < streams || result.Connects > requests.Load() {
+		t.Fatalf("connects %d, want between %d and %d", result.Connects, streams, requests.Load())
+	}
+	// Every stream ends its connections with the close message and reconnects after
+	// MinReconnectDelay, as neither the server nor the config sets a delay.
+	maxReconnects := int64(streams * (duration/MinReconnectDelay + 1))
+	if result.Reconnects < streams || result.Reconnects > maxReconnects {
+		t.Fatalf("reconnects %d, want between %d and %d", result.Reconnects, streams, maxReconnects)
+	}
+	if result.Connects != result.Reconnects+streams {
+		t.Fatalf("connects %d, want reconnects %d and streams %d", result.Connects, result.Reconnects, streams)
+	}
+	if lastEventID.Load() == 0 {
+		t.Fatal("reconnects did not send Last-Event-ID")
+	}
+
+	if result.Events < result.Connects*eventsPerConn-streams*eventsPerConn {
+		t.Fatalf("events %d too few for %d connects", result.Events, result.Connects)
+	}
+	if result.Events > result.Connects*eventsPerConn {
+		t.Fatalf("events %d exceed %d connects", result.Events, result.Connects)
+	}
+	if result.Invalid > result.Connects*invalidPerConn {
+		t.Fatalf("invalid %d exceed %d connects", result.Invalid, result.Connects)
+	}
+	if int64(len(result.Latencies)) != result.Events {
+		t.Fatalf("latencies %d, events %d", len(result.Latencies), result.Events)
+	}
+	for i, d := range result.Latencies {
+		if d < 0 || d > duration {
+			t.Fatalf("latency %v out of range", d)
+		}
+		if i > 0 && d < result.Latencies[i-1] {
+			t.Fatal("latencies are not sorted")
+		}
+	}
+	if max := result.Percentile(100); max != result.Latencies[len(result.Latencies)-1] {
+		t.Fatalf("p100 %v, want the max latency", max)
+	}
+
+	want := float64(result.Events) / result.Elapsed.Seconds()
+	if got := result.Throughput(); got != want || got <= 0 {
+		t.Fatalf("throughput %v, want %v", got, want)
+	}
+	if result.Elapsed < duration {
+		t.Fatalf("elapsed %v shorter than the duration", result.Elapsed)
+	}
+}
+
+func TestRunFailedReconnects(t *testing.T) {
+	var requests atomic.Int64
+	handler := sse.Handler(func(ctx context.Context, s *sse.Sender) error {
+		s.Send(&sse.Message{Data: fmt.Sprintf(`{"ts": %d}`, time.Now().UnixMilli())})
+		return nil
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every other reconnect fails.
+		if requests.Add(1)%2 == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	result, err := Run(context.Background(), srv.Client(), &Config{
+		URL:            srv.URL,
+		Streams:        1,
+		Duration:       300 * time.Millisecond,
+		Event:          sse.EventMessage,
+		TimestampField: "ts",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Failures == 0 {
+		t.Fatal("no failed reconnects")
+	}
+	if result.Reconnects != result.Connects-1 {
+		t.Fatalf("reconnects %d, want %d connects after the first one", result.Reconnects, result.Connects)
+	}
+	// The last request may be cut off by the end of the run.
+	if n := result.Connects + result.Failures; n != requests.Load() && n != requests.Load()-1 {
+		t.Fatalf("connects %d and failures %d, want %d requests", result.Connects, result.Failures, requests.Load())
+	}
+}
+
+func TestRunConfig(t *testing.T) {
+	if _, err := Run(context.Background(), nil, &Config{Streams: 1}); err == nil {
+		t.Fatal("expected an error without url")
+	}
+	if _, err := Run(context.Background(), nil, &Config{URL: "http://127.0.0.1"}); err == nil {
+		t.Fatal("expected an error without streams")
+	}
+	if _, err := Run(context.Background(), nil, &Config{URL: "http://127.0.0.1", Streams: 1, ReconnectDelay: time.Millisecond}); err == nil {
+		t.Fatal("expected an error with a reconnect delay below the floor")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := make([]time.Duration, 10)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	result := &Result{Latencies: latencies}
+
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{p: 0, want: 1 * time.Millisecond},
+		{p: 10, want: 1 * time.Millisecond},
+		{p: 11, want: 2 * time.Millisecond},
+		{p: 50, want: 5 * time.Millisecond},
+		{p: 91, want: 10 * time.Millisecond},
+		{p: 99, want: 10 * time.Millisecond},
+		{p: 100, want: 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := result.Percentile(tt.p); got != tt.want {
+			t.Errorf("p%v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	result = &Result{Latencies: latencies[:3]}
+	for p, want := range map[float64]time.Duration{50: 2 * time.Millisecond, 99: 3 * time.Millisecond, 100: 3 * time.Millisecond} {
+		if got := result.Percentile(p); got != want {
+			t.Errorf("p%v of 3 = %v, want %v", p, got, want)
+		}
+	}
+	if got := (&Result{}).Percentile(50); got != 0 {
+		t.Errorf("p50 of none = %v, want 0", got)
+	}
+}
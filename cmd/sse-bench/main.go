@@ -0,0 +1,119 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command sse-bench opens concurrent SSE streams against an endpoint
+// and reports the event latency, throughput and reconnect counts.
+//
+// The latency of an event is measured against a timestamp embedded by the server
+// in the json data of the event, e.g. `data: {"ts": 1700000000000}`.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/99nil/gopkg/printer"
+	"github.com/99nil/gopkg/sse"
+)
+
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return fmt.Sprintf("%v", http.Header(h))
+}
+
+func (h headerFlag) Set(value string) error {
+	k, v, ok := strings.Cut(value, ":")
+	if !ok {
+		return fmt.Errorf("invalid header %q, expected 'Key: Value'", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(k), strings.TrimSpace(v))
+	return nil
+}
+
+func main() {
+	var (
+		cfg  = &Config{Header: make(http.Header)}
+		unit string
+	)
+	flag.StringVar(&cfg.URL, "url", "", "url of the SSE endpoint")
+	flag.IntVar(&cfg.Streams, "c", 10, "number of concurrent streams")
+	flag.DurationVar(&cfg.Duration, "d", 30*time.Second, "duration of the benchmark")
+	flag.StringVar(&cfg.Event, "event", sse.EventMessage, "name of the event to measure")
+	flag.StringVar(&cfg.TimestampField, "ts-field", "ts", "json field of the event data holding the server timestamp")
+	flag.StringVar(&unit, "ts-unit", "ms", "unit of numeric timestamps, one of s, ms, us, ns")
+	flag.DurationVar(&cfg.ReconnectDelay, "reconnect-delay", time.Second, "reconnect delay if the server sends no retry, at least "+MinReconnectDelay.String())
+	flag.Var(headerFlag(cfg.Header), "H", "request header in 'Key: Value' format, can be repeated")
+	flag.Parse()
+
+	switch unit {
+	case "s":
+		cfg.TimestampUnit = time.Second
+	case "ms":
+		cfg.TimestampUnit = time.Millisecond
+	case "us":
+		cfg.TimestampUnit = time.Microsecond
+	case "ns":
+		cfg.TimestampUnit = time.Nanosecond
+	default:
+		fmt.Fprintf(os.Stderr, "invalid timestamp unit: %s\n", unit)
+		os.Exit(2)
+	}
+
+	if cfg.ReconnectDelay < MinReconnectDelay {
+		fmt.Fprintf(os.Stderr, "reconnect delay must be at least %v\n", MinReconnectDelay)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := Run(ctx, &http.Client{}, cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	Print(result)
+}
+
+// Print prints the result as a table to stdout.
+func Print(r *Result) {
+	tab := printer.NewTab("METRIC", "VALUE")
+	tab.Add("streams", strconv.Itoa(r.Streams))
+	tab.Add("elapsed", r.Elapsed.Round(time.Millisecond).String())
+	tab.Add("events", strconv.FormatInt(r.Events, 10))
+	tab.Add("throughput", strconv.FormatFloat(r.Throughput(), 'f', 2, 64)+"/s")
+	tab.Add("invalid", strconv.FormatInt(r.Invalid, 10))
+	tab.Add("errors", strconv.FormatInt(r.Errors, 10))
+	tab.Add("connects", strconv.FormatInt(r.Connects, 10))
+	tab.Add("reconnects", strconv.FormatInt(r.Reconnects, 10))
+	tab.Add("failures", strconv.FormatInt(r.Failures, 10))
+	if len(r.Latencies) > 0 {
+		tab.Add("latency min", r.Latencies[0].String())
+		tab.Add("latency mean", r.Mean().String())
+		for _, p := range []float64{50, 90, 95, 99} {
+			tab.Add("latency p"+strconv.FormatFloat(p, 'f', -1, 64), r.Percentile(p).String())
+		}
+		tab.Add("latency max", r.Latencies[len(r.Latencies)-1].String())
+	}
+	tab.Print()
+}
@@ -0,0 +1,366 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SourcePath   = "path"
+	SourceQuery  = "query"
+	SourceHeader = "header"
+	SourceForm   = "form"
+	SourceBody   = "body"
+)
+
+// bindSources are the struct tags read by Bind, in order of precedence.
+var bindSources = []string{SourcePath, SourceQuery, SourceHeader, SourceForm}
+
+var sourceNames = map[string]string{
+	SourcePath:   "path parameter",
+	SourceQuery:  "query parameter",
+	SourceHeader: "header",
+	SourceForm:   "form value",
+}
+
+// PathParam returns the path parameter of the request for the `path` tag of Bind,
+// it should be set to the accessor of the router in use, e.g. chi.URLParam.
+var PathParam = func(r *http.Request, name string) string {
+	return ""
+}
+
+// BindError is the error of binding a single field.
+type BindError struct {
+	// Field is the name of the struct field.
+	Field string
+	// Source is where the value came from, e.g. query.
+	Source string
+	// Name is the name of the value in the source, e.g. the query parameter.
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *BindError) Error() string {
+	if e.Source == SourceBody {
+		return fmt.Sprintf("invalid body: %v", e.Err)
+	}
+	return fmt.Sprintf("invalid %s %q: %v", sourceNames[e.Source], e.Name, e.Err)
+}
+
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+// BindErrors are the errors of all fields which failed to bind.
+type BindErrors []*BindError
+
+func (e BindErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Problem returns a 400 problem with the breakdown of every field in the errors member.
+func (e BindErrors) Problem() *Problem {
+	items := make([]map[string]any, 0, len(e))
+	for _, err := range e {
+		item := map[string]any{
+			"source": err.Source,
+			"detail": err.Err.Error(),
+		}
+		if err.Field != "" {
+			item["field"] = err.Field
+		}
+		if err.Name != "" {
+			item["name"] = err.Name
+		}
+		items = append(items, item)
+	}
+	return NewProblem(http.StatusBadRequest, e.Error()).With("errors", items)
+}
+
+// Bind fills the struct pointed to by v from the request and validates it.
+// The body is decoded by DefaultDecoder, then the fields are filled from the
+// `path`, `query`, `header` and `form` tags, e.g.
+//
+//	type ListRequest struct {
+//		Page   int       `query:"page"`
+//		Tenant string    `header:"X-Tenant"`
+//		Since  time.Time `query:"since"`
+//	}
+//
+// Strings, bools, numbers, time.Time, time.Duration, encoding.TextUnmarshaler,
+// pointers and slices of them are supported. The errors of all fields are returned as BindErrors.
+func Bind(r *http.Request, v any) error {
+	return DefaultResponder.Bind(r, v)
+}
+
+// Bind fills the struct pointed to by v from the request, decoding the body by the decoder of the responder.
+func (rs *Responder) Bind(r *http.Request, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("bind target must be a non-nil pointer")
+	}
+
+	var errs BindErrors
+	if hasBody(r) && !isForm(r) {
+		if err := rs.decode(r.Body, v); err != nil && err != io.EOF {
+			var tooLarge *BodyTooLargeError
+			if errors.As(err, &tooLarge) {
+				return err
+			}
+			errs = append(errs, &BindError{Source: SourceBody, Err: err})
+		}
+	}
+
+	if elem := rv.Elem(); elem.Kind() == reflect.Struct {
+		b := &binder{r: r}
+		b.bindStruct(elem, &errs)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return validate(v)
+}
+
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+func isForm(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded" || mediaType == "multipart/form-data"
+}
+
+type binder struct {
+	r     *http.Request
+	query url.Values
+	form  url.Values
+}
+
+func (b *binder) lookup(source, name string) ([]string, error) {
+	switch source {
+	case SourcePath:
+		if v := PathParam(b.r, name); v != "" {
+			return []string{v}, nil
+		}
+	case SourceQuery:
+		if b.query == nil {
+			b.query = b.r.URL.Query()
+		}
+		return b.query[name], nil
+	case SourceHeader:
+		return b.r.Header.Values(name), nil
+	case SourceForm:
+		if b.form == nil {
+			if err := parseForm(b.r); err != nil {
+				return nil, err
+			}
+			b.form = b.r.Form
+		}
+		return b.form[name], nil
+	}
+	return nil, nil
+}
+
+func parseForm(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "multipart/form-data" {
+		err := r.ParseMultipartForm(32 << 20)
+		if err != nil && err != http.ErrNotMultipart {
+			return err
+		}
+		return nil
+	}
+	return r.ParseForm()
+}
+
+func (b *binder) bindStruct(rv reflect.Value, errs *BindErrors) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fv := rv.Field(i)
+
+		bound := false
+		for _, source := range bindSources {
+			name, _, _ := strings.Cut(field.Tag.Get(source), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+
+			values, err := b.lookup(source, name)
+			if err == nil && len(values) == 0 {
+				continue
+			}
+			if err == nil {
+				err = setField(fv, values)
+			}
+			if err != nil {
+				*errs = append(*errs, &BindError{
+					Field:  field.Name,
+					Source: source,
+					Name:   name,
+					Value:  strings.Join(values, ","),
+					Err:    err,
+				})
+			}
+			bound = true
+			break
+		}
+		if bound {
+			continue
+		}
+
+		// Embedded and nested structs are bound field by field.
+		switch {
+		case fv.Kind() == reflect.Struct && !isScalar(fv.Type()):
+			b.bindStruct(fv, errs)
+		case field.Anonymous && fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct:
+			if fv.IsNil() {
+				fv.Set(reflect.New(fv.Type().Elem()))
+			}
+			b.bindStruct(fv.Elem(), errs)
+		}
+	}
+}
+
+var (
+	durationType        = reflect.TypeOf(time.Duration(0))
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isScalar reports whether the struct type is bound from a single value.
+func isScalar(t reflect.Type) bool {
+	return t == timeType || reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
+
+func setField(fv reflect.Value, values []string) error {
+	switch {
+	case fv.Kind() == reflect.Pointer:
+		elem := reflect.New(fv.Type().Elem())
+		if err := setField(elem.Elem(), values); err != nil {
+			return err
+		}
+		fv.Set(elem)
+		return nil
+	case fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8:
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	return setValue(fv, values[0])
+}
+
+func setValue(fv reflect.Value, value string) error {
+	if fv.Kind() == reflect.Pointer {
+		return setField(fv, []string{value})
+	}
+
+	switch fv.Type() {
+	case timeType:
+		t, err := parseTime(value)
+		if err != nil {
+			return err
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if fv.CanAddr() && fv.Addr().Type().Implements(textUnmarshalerType) {
+		return fv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return convertError(value, fv.Type())
+		}
+		fv.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return convertError(value, fv.Type())
+		}
+		fv.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return convertError(value, fv.Type())
+		}
+		fv.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return convertError(value, fv.Type())
+		}
+		fv.SetFloat(v)
+	case reflect.Slice:
+		// []byte
+		fv.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("unsupported type %s", fv.Type())
+	}
+	return nil
+}
+
+func convertError(value string, t reflect.Type) error {
+	return fmt.Errorf("cannot convert %q to %s", value, t)
+}
+
+// parseTime accepts RFC3339 timestamps, dates and unix seconds.
+func parseTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected RFC3339, date or unix seconds", value)
+}
@@ -0,0 +1,245 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Conditional defines the validators of a conditional response.
+type Conditional struct {
+	// ETag is the entity tag of the representation, e.g. `"v1"` or `W/"v1"`,
+	// bare values are quoted. If empty, ConditionalOK computes it from the encoded body.
+	ETag string
+	// Weak makes the computed entity tag a weak one.
+	Weak bool
+	// LastModified is the modification time of the representation, ignored if zero.
+	LastModified time.Time
+}
+
+// StrongETag returns the strong entity tag of the content.
+func StrongETag(content []byte) string {
+	sum := sha256.Sum256(content)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns the weak entity tag of the content.
+func WeakETag(content []byte) string {
+	return "W/" + StrongETag(content)
+}
+
+// ConditionalOK writes the json-encoded data to the response with the ETag and Last-Modified headers.
+// It replies 304 not modified to GET and HEAD requests whose If-None-Match or If-Modified-Since
+// condition matches the representation, and 412 precondition failed to other requests
+// whose If-None-Match condition matches.
+func ConditionalOK(w http.ResponseWriter, r *http.Request, v any, c Conditional) {
+	DefaultResponder.ConditionalOK(w, r, v, c)
+}
+
+// ConditionalOK writes the encoded data to the response with the ETag and Last-Modified headers.
+func (rs *Responder) ConditionalOK(w http.ResponseWriter, r *http.Request, v any, c Conditional) {
+	var buf bytes.Buffer
+	if err := rs.encoder(&buf, v); err != nil {
+		rs.InternalError(w, err)
+		return
+	}
+
+	etag := quoteETag(c.ETag)
+	if etag == "" {
+		if c.Weak {
+			etag = WeakETag(buf.Bytes())
+		} else {
+			etag = StrongETag(buf.Bytes())
+		}
+	}
+	setValidators(w, etag, c.LastModified)
+
+	if !checkIfMatch(r, etag, c.LastModified) {
+		rs.PreconditionFailed(w)
+		return
+	}
+	if !checkIfNoneMatch(r, etag, c.LastModified) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			notModified(w)
+			return
+		}
+		rs.PreconditionFailed(w)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// CheckPreconditions evaluates the If-Match and If-Unmodified-Since preconditions of an update
+// against the current validators of the resource, an empty ETag means the resource does not exist.
+// It replies 412 precondition failed and returns false if they fail, e.g.
+//
+//	if !ctr.CheckPreconditions(w, r, ctr.Conditional{ETag: user.Version}) {
+//		return
+//	}
+func CheckPreconditions(w http.ResponseWriter, r *http.Request, c Conditional) bool {
+	return DefaultResponder.CheckPreconditions(w, r, c)
+}
+
+// CheckPreconditions evaluates the If-Match and If-Unmodified-Since preconditions of an update.
+func (rs *Responder) CheckPreconditions(w http.ResponseWriter, r *http.Request, c Conditional) bool {
+	etag := quoteETag(c.ETag)
+	if !checkIfMatch(r, etag, c.LastModified) {
+		rs.PreconditionFailed(w)
+		return false
+	}
+	return true
+}
+
+// PreconditionFailed writes the json-encoded error message to the response
+// with a 412 precondition failed status code.
+func PreconditionFailed(w http.ResponseWriter, v ...any) {
+	ErrorCode(w, http.StatusPreconditionFailed, v...)
+}
+
+// PreconditionFailed writes the error message to the response
+// with a 412 precondition failed status code.
+func (rs *Responder) PreconditionFailed(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusPreconditionFailed, v...)
+}
+
+func setValidators(w http.ResponseWriter, etag string, modtime time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !isZeroTime(modtime) {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+}
+
+func notModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// checkIfMatch reports whether the If-Match or, in its absence,
+// the If-Unmodified-Since precondition passes.
+func checkIfMatch(r *http.Request, etag string, modtime time.Time) bool {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		ius := r.Header.Get("If-Unmodified-Since")
+		if ius == "" || isZeroTime(modtime) {
+			return true
+		}
+		t, err := http.ParseTime(ius)
+		if err != nil {
+			return true
+		}
+		return !modtime.Truncate(time.Second).After(t)
+	}
+	if etag == "" {
+		return false
+	}
+	if strings.TrimSpace(im) == "*" {
+		return true
+	}
+	return matchETags(im, etag, false)
+}
+
+// checkIfNoneMatch reports whether the If-None-Match or, in its absence for GET and HEAD requests,
+// the If-Modified-Since condition passes, which means the representation has been modified.
+func checkIfNoneMatch(r *http.Request, etag string, modtime time.Time) bool {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			return true
+		}
+		ims := r.Header.Get("If-Modified-Since")
+		if ims == "" || isZeroTime(modtime) {
+			return true
+		}
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return true
+		}
+		return modtime.Truncate(time.Second).After(t)
+	}
+	if etag == "" {
+		return true
+	}
+	if strings.TrimSpace(inm) == "*" {
+		return false
+	}
+	return !matchETags(inm, etag, true)
+}
+
+// matchETags reports whether the list of entity tags contains the tag,
+// by the weak comparison if weak is true, or else by the strong comparison.
+func matchETags(list, etag string, weak bool) bool {
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return false
+		}
+		candidate, remain := scanETag(list)
+		if candidate == "" {
+			return false
+		}
+		if weak && strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+		if !weak && !isWeakETag(candidate) && !isWeakETag(etag) && candidate == etag {
+			return true
+		}
+		list = remain
+	}
+}
+
+// scanETag returns the entity tag at the start of s and the rest of s.
+func scanETag(s string) (etag, remain string) {
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s)-start < 2 || s[start] != '"' {
+		return "", ""
+	}
+	end := strings.IndexByte(s[start+1:], '"')
+	if end < 0 {
+		return "", ""
+	}
+	end += start + 2
+	return s[:end], s[end:]
+}
+
+func isWeakETag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// quoteETag quotes the bare entity tag.
+func quoteETag(etag string) string {
+	if etag == "" || strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+func isZeroTime(t time.Time) bool {
+	return t.IsZero() || t.Equal(time.Unix(0, 0))
+}
@@ -14,10 +14,7 @@
 
 package ctr
 
-import (
-	"encoding/json"
-	"net/http"
-)
+import "net/http"
 
 // Bytes writes the Bytes message to the response.
 func Bytes(w http.ResponseWriter, bytes []byte) {
@@ -55,37 +52,66 @@ func Found(w http.ResponseWriter, r *http.Request, url string) {
 // JSON writes the json-encoded error message to the response
 // with a 400 bad request status code.
 func JSON(w http.ResponseWriter, v any, status int) {
+	DefaultResponder.JSON(w, v, status)
+}
+
+// JSON writes the encoded data to the response with the status code.
+func (rs *Responder) JSON(w http.ResponseWriter, v any, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if v != nil {
-		_ = json.NewEncoder(w).Encode(v)
+		_ = rs.encoder(w, v)
 	}
 }
 
 // OK writes the json-encoded data to the response.
 func OK(w http.ResponseWriter, v any) {
-	JSON(w, v, http.StatusOK)
+	DefaultResponder.OK(w, v)
+}
+
+// OK writes the encoded data to the response.
+func (rs *Responder) OK(w http.ResponseWriter, v any) {
+	rs.JSON(w, v, http.StatusOK)
 }
 
 // ErrorCode writes the json-encoded error message to the response.
+// If the error carries problem details, they are written as application/problem+json
+// with the status of the problem, or the given status if the problem has none.
 func ErrorCode(w http.ResponseWriter, status int, v ...any) {
+	DefaultResponder.ErrorCode(w, status, v...)
+}
+
+// ErrorCode writes the error message in the error envelope to the response.
+// If the error carries problem details, they are written as application/problem+json.
+func (rs *Responder) ErrorCode(w http.ResponseWriter, status int, v ...any) {
 	var errStr string
 	if len(v) > 0 {
-		ev := RunHookError(v...)
-		switch vv := ev.(type) {
-		case error:
-			errStr = vv.Error()
-		case string:
-			errStr = vv
+		ev := rs.RunHookError(v...)
+		if p, ok := AsProblem(ev); ok {
+			p = p.withStatus(status)
+			rs.logger.Error(p.Error(), logFields(w, p.Status)...)
+			ProblemJSON(w, p)
+			return
 		}
+		errStr = errorString(ev)
 	}
 	if errStr == "" {
 		w.WriteHeader(status)
 		return
 	}
 
-	logger.Error(errStr)
-	JSON(w, errStr, status)
+	rs.logger.Error(errStr, logFields(w, status)...)
+	rs.JSON(w, rs.errorBody(status, errStr), status)
+}
+
+func errorString(v any) string {
+	switch vv := v.(type) {
+	case error:
+		return vv.Error()
+	case string:
+		return vv
+	}
+	return ""
 }
 
 // InternalError writes the json-encoded error message to the response
@@ -94,32 +120,92 @@ func InternalError(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusInternalServerError, v...)
 }
 
+// InternalError writes the error message to the response
+// with a 500 internal server error.
+func (rs *Responder) InternalError(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusInternalServerError, v...)
+}
+
 // NotImplemented writes the json-encoded error message to the
-// response with a 501 not found status code.
+// response with a 501 not implemented status code.
 func NotImplemented(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusNotImplemented, v...)
 }
 
+// NotImplemented writes the error message to the
+// response with a 501 not implemented status code.
+func (rs *Responder) NotImplemented(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusNotImplemented, v...)
+}
+
 // NotFound writes the json-encoded error message to the response
 // with a 404 not found status code.
 func NotFound(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusNotFound, v...)
 }
 
+// NotFound writes the error message to the response
+// with a 404 not found status code.
+func (rs *Responder) NotFound(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusNotFound, v...)
+}
+
 // Unauthorized writes the json-encoded error message to the response
 // with a 401 unauthorized status code.
 func Unauthorized(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusUnauthorized, v...)
 }
 
+// Unauthorized writes the error message to the response
+// with a 401 unauthorized status code.
+func (rs *Responder) Unauthorized(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusUnauthorized, v...)
+}
+
 // Forbidden writes the json-encoded error message to the response
 // with a 403 forbidden status code.
 func Forbidden(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusForbidden, v...)
 }
 
+// Forbidden writes the error message to the response
+// with a 403 forbidden status code.
+func (rs *Responder) Forbidden(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusForbidden, v...)
+}
+
 // BadRequest writes the json-encoded error message to the response
 // with a 400 bad request status code.
 func BadRequest(w http.ResponseWriter, v ...any) {
 	ErrorCode(w, http.StatusBadRequest, v...)
 }
+
+// BadRequest writes the error message to the response
+// with a 400 bad request status code.
+func (rs *Responder) BadRequest(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusBadRequest, v...)
+}
+
+// NotAcceptable writes the json-encoded error message to the response
+// with a 406 not acceptable status code.
+func NotAcceptable(w http.ResponseWriter, v ...any) {
+	ErrorCode(w, http.StatusNotAcceptable, v...)
+}
+
+// NotAcceptable writes the error message to the response
+// with a 406 not acceptable status code.
+func (rs *Responder) NotAcceptable(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusNotAcceptable, v...)
+}
+
+// TooManyRequests writes the json-encoded error message to the response
+// with a 429 too many requests status code.
+func TooManyRequests(w http.ResponseWriter, v ...any) {
+	ErrorCode(w, http.StatusTooManyRequests, v...)
+}
+
+// TooManyRequests writes the error message to the response
+// with a 429 too many requests status code.
+func (rs *Responder) TooManyRequests(w http.ResponseWriter, v ...any) {
+	rs.ErrorCode(w, http.StatusTooManyRequests, v...)
+}
@@ -16,7 +16,12 @@ package ctr
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"strconv"
+	"strings"
 )
 
 var DefaultDecoder = func(r io.Reader, v any) error {
@@ -28,24 +33,192 @@ type Validator interface {
 }
 
 func Decode(r io.Reader, v any) error {
-	if err := DefaultDecoder(r, v); err != nil {
-		return err
-	}
-	if vv, ok := v.(Validator); ok {
-		return vv.Validate()
-	}
-	return nil
+	return DefaultResponder.Decode(r, v)
+}
+
+// Decode decodes v by the decoder of the responder and validates it.
+func (rs *Responder) Decode(r io.Reader, v any) error {
+	return rs.CustomDecode(r, v, nil)
 }
 
 func CustomDecode(r io.Reader, v any, decoder func(r io.Reader, v any) error) error {
+	return DefaultResponder.CustomDecode(r, v, decoder)
+}
+
+// CustomDecode decodes v by the decoder, or the decoder of the responder if nil, and validates it.
+func (rs *Responder) CustomDecode(r io.Reader, v any, decoder func(r io.Reader, v any) error) error {
 	if decoder == nil {
-		decoder = DefaultDecoder
+		decoder = rs.decode
 	}
 	if err := decoder(r, v); err != nil {
 		return err
 	}
+	return validate(v)
+}
+
+// validate checks the ValidateTag rules of v, then runs its Validator.
+func validate(v any) error {
+	if err := ValidateStruct(v); err != nil {
+		return err
+	}
 	if vv, ok := v.(Validator); ok {
 		return vv.Validate()
 	}
 	return nil
 }
+
+// DecodeOptions configures the json decoder returned by NewJSONDecoder.
+type DecodeOptions struct {
+	// MaxBodySize is the maximum size of the body in bytes, 0 means no limit.
+	// A larger body fails with *BodyTooLargeError.
+	MaxBodySize int64
+	// DisallowUnknownFields rejects fields which do not exist in the target.
+	DisallowUnknownFields bool
+	// DisallowTrailingData rejects any data after the json value.
+	DisallowTrailingData bool
+	// UseNumber decodes numbers into interface values as json.Number instead of float64.
+	UseNumber bool
+}
+
+// NewJSONDecoder returns a json decoder with the options,
+// it can be set as DefaultDecoder or passed to CustomDecode.
+// Invalid bodies fail with *DecodeError, which points at the offending field or offset.
+func NewJSONDecoder(opts DecodeOptions) func(r io.Reader, v any) error {
+	return func(r io.Reader, v any) error {
+		if opts.MaxBodySize > 0 {
+			r = &limitedReader{r: r, n: opts.MaxBodySize, limit: opts.MaxBodySize}
+		}
+		cr := &countReader{r: r}
+
+		dec := json.NewDecoder(cr)
+		if opts.DisallowUnknownFields {
+			dec.DisallowUnknownFields()
+		}
+		if opts.UseNumber {
+			dec.UseNumber()
+		}
+		if err := dec.Decode(v); err != nil {
+			return coverDecodeError(err, dec.InputOffset(), cr.n)
+		}
+		if opts.DisallowTrailingData {
+			offset := dec.InputOffset()
+			if _, err := dec.Token(); err != io.EOF {
+				var tooLarge *BodyTooLargeError
+				if errors.As(err, &tooLarge) {
+					return err
+				}
+				return &DecodeError{Offset: offset, Err: errors.New("unexpected data after the json value")}
+			}
+		}
+		return nil
+	}
+}
+
+// DecodeError is the error of decoding an invalid body.
+type DecodeError struct {
+	// Field is the path of the field with an invalid value, if known.
+	Field string
+	// Offset is the byte offset in the body where the error occurred.
+	Offset int64
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("invalid field %q at offset %d: %v", e.Field, e.Offset, e.Err)
+	}
+	return fmt.Sprintf("invalid body at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Problem returns a 400 problem with the field and the offset members.
+func (e *DecodeError) Problem() *Problem {
+	p := NewProblem(http.StatusBadRequest, e.Error()).With("offset", e.Offset)
+	if e.Field != "" {
+		p.With("field", e.Field)
+	}
+	return p
+}
+
+// BodyTooLargeError is the error of a body exceeding DecodeOptions.MaxBodySize.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body too large, the limit is %d bytes", e.Limit)
+}
+
+// Problem returns a 413 problem with the limit member.
+func (e *BodyTooLargeError) Problem() *Problem {
+	return NewProblem(http.StatusRequestEntityTooLarge, e.Error()).With("limit", e.Limit)
+}
+
+// limitedReader fails with *BodyTooLargeError once more than limit bytes are read.
+type limitedReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, &BodyTooLargeError{Limit: l.limit}
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		return n, err
+	}
+	n = int(l.n)
+	l.n = -1
+	return n, &BodyTooLargeError{Limit: l.limit}
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// coverDecodeError converts the errors of json.Decoder into *DecodeError,
+// offset is the input offset of the decoder and read is the number of bytes read from the body.
+func coverDecodeError(err error, offset, read int64) error {
+	var (
+		syntaxErr    *json.SyntaxError
+		typeErr      *json.UnmarshalTypeError
+		tooLargeErr  *BodyTooLargeError
+		unknownField = "json: unknown field "
+	)
+	switch {
+	case err == io.EOF:
+		return err
+	case errors.As(err, &tooLargeErr):
+		return err
+	case errors.As(err, &syntaxErr):
+		return &DecodeError{Offset: syntaxErr.Offset, Err: errors.New(strings.TrimPrefix(syntaxErr.Error(), "json: "))}
+	case errors.As(err, &typeErr):
+		return &DecodeError{
+			Field:  typeErr.Field,
+			Offset: typeErr.Offset,
+			Err:    fmt.Errorf("cannot use %s as %s", typeErr.Value, typeErr.Type),
+		}
+	case err == io.ErrUnexpectedEOF:
+		return &DecodeError{Offset: read, Err: errors.New("unexpected end of json")}
+	case strings.HasPrefix(err.Error(), unknownField):
+		field, _ := strconv.Unquote(strings.TrimPrefix(err.Error(), unknownField))
+		return &DecodeError{Field: field, Offset: offset, Err: errors.New("unknown field")}
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// DefaultErrorRegistry is used by Error and RegisterError.
+var DefaultErrorRegistry = NewErrorRegistry()
+
+// ErrorRegistry maps errors to the status code and the public message of the response.
+type ErrorRegistry struct {
+	mu      sync.RWMutex
+	entries []errorEntry
+}
+
+type errorEntry struct {
+	match   func(err error) bool
+	status  int
+	message string
+}
+
+func NewErrorRegistry() *ErrorRegistry {
+	return new(ErrorRegistry)
+}
+
+// Register maps the errors matching the target by errors.Is to the status.
+// The message replaces the error message in the response, if empty,
+// the error message is used for 4xx and the status text for 5xx responses.
+func (r *ErrorRegistry) Register(target error, status int, message string) {
+	r.RegisterFunc(func(err error) bool {
+		return errors.Is(err, target)
+	}, status, message)
+}
+
+// RegisterFunc maps the errors matched by the function to the status.
+func (r *ErrorRegistry) RegisterFunc(match func(err error) bool, status int, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, errorEntry{match: match, status: status, message: message})
+}
+
+// RegisterErrorType maps the errors of type T, found by errors.As, to the status.
+func RegisterErrorType[T error](r *ErrorRegistry, status int, message string) {
+	r.RegisterFunc(func(err error) bool {
+		var target T
+		return errors.As(err, &target)
+	}, status, message)
+}
+
+// Lookup returns the status and the message of the first registered mapping which matches the error.
+func (r *ErrorRegistry) Lookup(err error) (status int, message string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, entry := range r.entries {
+		if entry.match(err) {
+			return entry.status, entry.message, true
+		}
+	}
+	return 0, "", false
+}
+
+// RegisterError maps the errors matching the target to the status in DefaultErrorRegistry.
+func RegisterError(target error, status int, message string) {
+	DefaultErrorRegistry.Register(target, status, message)
+}
+
+// Error writes the error to the response with the status mapped by DefaultErrorRegistry,
+// unmapped errors are 500 internal server errors. The error is logged in full,
+// while 5xx responses only expose the registered message or the status text.
+func Error(w http.ResponseWriter, err error) {
+	DefaultResponder.Error(w, err)
+}
+
+// Error writes the error to the response with the status mapped by the error registry of the responder.
+func (rs *Responder) Error(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+
+	ev := rs.RunHookError(err)
+	lookupErr := err
+	if e, ok := ev.(error); ok {
+		lookupErr = e
+	}
+	status, message, ok := rs.errorRegistry().Lookup(lookupErr)
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	if p, ok := AsProblem(ev); ok {
+		p = p.withStatus(status)
+		rs.logger.Error(p.Error(), logFields(w, p.Status)...)
+		ProblemJSON(w, p)
+		return
+	}
+
+	errStr := errorString(ev)
+	if message == "" {
+		if status < http.StatusInternalServerError {
+			message = errStr
+		} else {
+			message = http.StatusText(status)
+		}
+	}
+	if errStr != "" {
+		rs.logger.Error(errStr, logFields(w, status)...)
+	}
+	rs.JSON(w, rs.errorBody(status, message), status)
+}
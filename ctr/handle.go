@@ -0,0 +1,82 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+)
+
+// Handle adapts a typed function to an http.Handler.
+// The request is bound by Bind, which decodes and validates it,
+// binding errors are written as 400 bad request unless they carry their own status.
+// The response is written by OK, or NoContent if it is nil or an empty struct,
+// and the errors of fn are written by Error.
+//
+//	mux.Handle("/users", ctr.Handle(func(ctx context.Context, req *CreateUserRequest) (*User, error) {
+//		return svc.CreateUser(ctx, req)
+//	}))
+func Handle[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error)) http.Handler {
+	return HandleWith(DefaultResponder, fn)
+}
+
+// HandleWith adapts a typed function to an http.Handler like Handle, using the responder.
+func HandleWith[Req, Resp any](rs *Responder, fn func(ctx context.Context, req Req) (Resp, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w = NewResponseWriter(w, r)
+
+		var req Req
+		target := any(&req)
+		if t := reflect.TypeOf(req); t != nil && t.Kind() == reflect.Pointer {
+			req = reflect.New(t.Elem()).Interface().(Req)
+			target = req
+		}
+
+		if err := rs.Bind(r, target); err != nil {
+			if p, ok := AsProblem(err); ok && p.Status != 0 {
+				rs.Error(w, err)
+				return
+			}
+			rs.BadRequest(w, err)
+			return
+		}
+
+		resp, err := fn(r.Context(), req)
+		if err != nil {
+			rs.Error(w, err)
+			return
+		}
+		if isEmptyResponse(resp) {
+			NoContent(w)
+			return
+		}
+		rs.OK(w, resp)
+	})
+}
+
+func isEmptyResponse(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return rv.IsNil()
+	case reflect.Struct:
+		return rv.NumField() == 0
+	}
+	return false
+}
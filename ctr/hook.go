@@ -14,18 +14,12 @@
 
 package ctr
 
-var hookError func(vs ...any) any
-
+// HookError sets the error hook of DefaultResponder.
 func HookError(hook func(vs ...any) any) {
-	hookError = hook
+	DefaultResponder.HookError(hook)
 }
 
+// RunHookError runs the error hook of DefaultResponder.
 func RunHookError(vs ...any) any {
-	if hookError != nil {
-		return hookError(vs...)
-	}
-	if len(vs) > 0 {
-		return vs[0]
-	}
-	return nil
+	return DefaultResponder.RunHookError(vs...)
 }
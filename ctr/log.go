@@ -20,18 +20,34 @@ type Log interface {
 	Error(vs ...any)
 }
 
-// logInstance defines the log processing method
-var logger Log = new(emptyLogger)
+// LevelLog is a levelled, structured logger,
+// the fields are alternating keys and values, e.g. "status", 500.
+type LevelLog interface {
+	Debug(msg string, fields ...any)
+	Info(msg string, fields ...any)
+	Warn(msg string, fields ...any)
+	Error(msg string, fields ...any)
+}
 
-// Logger returns the default logger instance
+// Logger returns the logger of DefaultResponder
 func Logger() Log {
-	return logger
+	return DefaultResponder.Logger()
 }
 
+// SetLog sets the logger of DefaultResponder,
+// a Log only receives the error messages, the fields are passed to a LevelLog or a KVLog.
 func SetLog(l Log) {
-	if l != nil {
-		logger = l
-	}
+	DefaultResponder.SetLog(l)
+}
+
+// LevelLogger returns the levelled logger of DefaultResponder
+func LevelLogger() LevelLog {
+	return DefaultResponder.LevelLogger()
+}
+
+// SetLevelLog sets the levelled logger of DefaultResponder
+func SetLevelLog(l LevelLog) {
+	DefaultResponder.SetLevelLog(l)
 }
 
 // InitLogger initialization the log processing method
@@ -40,8 +56,15 @@ var InitLogger = SetLog
 
 type emptyLogger struct{}
 
-func (l *emptyLogger) Error(vs ...any) {}
+func (l *emptyLogger) Debug(msg string, fields ...any) {}
+
+func (l *emptyLogger) Info(msg string, fields ...any) {}
+
+func (l *emptyLogger) Warn(msg string, fields ...any) {}
 
+func (l *emptyLogger) Error(msg string, fields ...any) {}
+
+// CoverKVLog covers the KVLog as Log, the first value is the message and the rest are the fields.
 func CoverKVLog(logger KVLog) Log {
 	return &coverLog{logger: logger}
 }
@@ -55,11 +78,76 @@ type coverLog struct {
 }
 
 func (l *coverLog) Error(vs ...any) {
-	for _, v := range vs {
-		str, ok := v.(string)
-		if !ok {
-			str = fmt.Sprintf("%v", v)
-		}
-		l.logger.Error(str)
+	if len(vs) == 0 {
+		return
+	}
+	msg, ok := vs[0].(string)
+	if !ok {
+		msg = fmt.Sprintf("%v", vs[0])
 	}
+	l.logger.Error(msg, vs[1:]...)
+}
+
+// FromKVLog adapts the KVLog to LevelLog. Debug, Info and Warn are passed on
+// if the logger has them with the same signature, or else discarded.
+func FromKVLog(logger KVLog) LevelLog {
+	l := &kvLevelLog{KVLog: logger}
+	if v, ok := logger.(interface{ Debug(string, ...any) }); ok {
+		l.debug = v.Debug
+	}
+	if v, ok := logger.(interface{ Info(string, ...any) }); ok {
+		l.info = v.Info
+	}
+	if v, ok := logger.(interface{ Warn(string, ...any) }); ok {
+		l.warn = v.Warn
+	}
+	return l
+}
+
+type kvLevelLog struct {
+	KVLog
+	debug, info, warn func(msg string, fields ...any)
+}
+
+func (l *kvLevelLog) Debug(msg string, fields ...any) {
+	if l.debug != nil {
+		l.debug(msg, fields...)
+	}
+}
+
+func (l *kvLevelLog) Info(msg string, fields ...any) {
+	if l.info != nil {
+		l.info(msg, fields...)
+	}
+}
+
+func (l *kvLevelLog) Warn(msg string, fields ...any) {
+	if l.warn != nil {
+		l.warn(msg, fields...)
+	}
+}
+
+// legacyLog adapts Log to LevelLog, only the messages of errors are logged
+// as they were before the fields were added.
+type legacyLog struct {
+	logger Log
+}
+
+func (l *legacyLog) Debug(msg string, fields ...any) {}
+
+func (l *legacyLog) Info(msg string, fields ...any) {}
+
+func (l *legacyLog) Warn(msg string, fields ...any) {}
+
+func (l *legacyLog) Error(msg string, fields ...any) {
+	l.logger.Error(msg)
+}
+
+// errorLog adapts LevelLog to Log.
+type errorLog struct {
+	logger LevelLog
+}
+
+func (l *errorLog) Error(vs ...any) {
+	(&coverLog{logger: l.logger}).Error(vs...)
 }
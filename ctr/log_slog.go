@@ -0,0 +1,27 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.21
+
+package ctr
+
+import "log/slog"
+
+// FromSlog adapts the slog logger to LevelLog, slog.Default() if nil.
+func FromSlog(logger *slog.Logger) LevelLog {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return logger
+}
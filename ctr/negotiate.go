@@ -0,0 +1,263 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	MIMEJSON = "application/json"
+	MIMEXML  = "application/xml"
+	MIMEText = "text/plain"
+)
+
+// EncodeFunc encodes v into w.
+type EncodeFunc func(w io.Writer, v any) error
+
+// DefaultNegotiator is used by Negotiate and NegotiateOK.
+var DefaultNegotiator = NewNegotiator()
+
+// Negotiator picks the encoder of the response by the Accept header of the request.
+type Negotiator struct {
+	mu          sync.RWMutex
+	encoders    map[string]*encoder
+	order       []string
+	defaultType string
+}
+
+type encoder struct {
+	contentType string
+	encode      EncodeFunc
+}
+
+// NewNegotiator returns a negotiator with the built-in json, xml and text encoders,
+// json is the default when the request accepts any type.
+func NewNegotiator() *Negotiator {
+	n := &Negotiator{encoders: make(map[string]*encoder)}
+	n.Register(MIMEJSON, encodeJSON)
+	n.Register(MIMEXML+"; charset=utf-8", encodeXML)
+	n.Register(MIMEText+"; charset=utf-8", encodeText)
+	n.SetDefault(MIMEJSON)
+	return n
+}
+
+// Register adds or replaces the encoder of the content type, e.g. "application/yaml".
+// Parameters of the content type like charset are kept in the Content-Type header.
+func (n *Negotiator) Register(contentType string, fn EncodeFunc) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || fn == nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.encoders[mediaType]; !ok {
+		n.order = append(n.order, mediaType)
+	}
+	n.encoders[mediaType] = &encoder{contentType: contentType, encode: fn}
+}
+
+// SetDefault sets the media type used when the request has no preference,
+// it must be registered.
+func (n *Negotiator) SetDefault(mediaType string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.defaultType = mediaType
+}
+
+// Negotiate returns the content type and the encoder which best match the Accept header,
+// ok is false if none of the registered encoders is acceptable.
+func (n *Negotiator) Negotiate(accept string) (contentType string, fn EncodeFunc, ok bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		if enc, ok := n.encoders[n.defaultType]; ok {
+			return enc.contentType, enc.encode, true
+		}
+		return "", nil, false
+	}
+
+	var (
+		best  *encoder
+		bestQ float64
+	)
+	candidates := make([]string, 0, len(n.order)+1)
+	candidates = append(candidates, n.defaultType)
+	candidates = append(candidates, n.order...)
+	for _, mediaType := range candidates {
+		enc, ok := n.encoders[mediaType]
+		if !ok {
+			continue
+		}
+		if q := acceptQuality(ranges, mediaType); q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	if best == nil {
+		return "", nil, false
+	}
+	return best.contentType, best.encode, true
+}
+
+// Types returns the registered media types.
+func (n *Negotiator) Types() []string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return append([]string(nil), n.order...)
+}
+
+// Write writes v encoded by the negotiated encoder to the response,
+// it replies 406 not acceptable if no encoder matches.
+func (n *Negotiator) Write(w http.ResponseWriter, r *http.Request, v any, status int) {
+	n.WriteWith(DefaultResponder, w, r, v, status)
+}
+
+// WriteWith writes v like Write, the errors are written by the responder.
+func (n *Negotiator) WriteWith(rs *Responder, w http.ResponseWriter, r *http.Request, v any, status int) {
+	w.Header().Add("Vary", "Accept")
+	contentType, encode, ok := n.Negotiate(r.Header.Get("Accept"))
+	if !ok {
+		rs.NotAcceptable(w, "not acceptable, available types: "+strings.Join(n.Types(), ", "))
+		return
+	}
+	if v == nil {
+		w.WriteHeader(status)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := encode(&buf, v); err != nil {
+		rs.InternalError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_, _ = buf.WriteTo(w)
+}
+
+// Negotiate writes v encoded by the type negotiated from the Accept header of the request.
+func Negotiate(w http.ResponseWriter, r *http.Request, v any, status int) {
+	DefaultResponder.Negotiate(w, r, v, status)
+}
+
+// Negotiate writes v encoded by the type negotiated by DefaultNegotiator,
+// the errors are written by the responder.
+func (rs *Responder) Negotiate(w http.ResponseWriter, r *http.Request, v any, status int) {
+	DefaultNegotiator.WriteWith(rs, w, r, v, status)
+}
+
+// NegotiateOK writes v encoded by the negotiated type with a 200 ok status code.
+func NegotiateOK(w http.ResponseWriter, r *http.Request, v any) {
+	DefaultResponder.NegotiateOK(w, r, v)
+}
+
+// NegotiateOK writes v encoded by the negotiated type with a 200 ok status code.
+func (rs *Responder) NegotiateOK(w http.ResponseWriter, r *http.Request, v any) {
+	rs.Negotiate(w, r, v, http.StatusOK)
+}
+
+func encodeJSON(w io.Writer, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func encodeXML(w io.Writer, v any) error {
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func encodeText(w io.Writer, v any) error {
+	var err error
+	switch vv := v.(type) {
+	case string:
+		_, err = io.WriteString(w, vv)
+	case []byte:
+		_, err = w.Write(vv)
+	case error:
+		_, err = io.WriteString(w, vv.Error())
+	case fmt.Stringer:
+		_, err = io.WriteString(w, vv.String())
+	default:
+		_, err = fmt.Fprintf(w, "%v", vv)
+	}
+	return err
+}
+
+type acceptRange struct {
+	typ     string
+	subtype string
+	q       float64
+}
+
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		typ, subtype, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil || q < 0 || q > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptRange{typ: typ, subtype: subtype, q: q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality of the most specific range matching the media type.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	typ, subtype, _ := strings.Cut(mediaType, "/")
+
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.typ == typ && r.subtype == subtype:
+			s = 2
+		case r.typ == typ && r.subtype == "*":
+			s = 1
+		case r.typ == "*" && r.subtype == "*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
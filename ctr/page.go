@@ -0,0 +1,244 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	QueryOffset = "offset"
+	QueryLimit  = "limit"
+	QueryCursor = "cursor"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PageOptions defines the bounds of the page parameters.
+type PageOptions struct {
+	// DefaultLimit is used when the limit is absent, DefaultPageLimit if 0.
+	DefaultLimit int
+	// MaxLimit is the largest accepted limit, MaxPageLimit if 0.
+	MaxLimit int
+	// Cursor verifies the cursor parameter if set.
+	Cursor *CursorCodec
+}
+
+// PageRequest is the page requested by the offset, limit and cursor query parameters.
+type PageRequest struct {
+	Offset int
+	Limit  int
+	// Cursor is the opaque cursor token, decode it by CursorCodec.Decode.
+	Cursor string
+}
+
+// ParsePage parses the page parameters of the request within the bounds of the options,
+// invalid parameters are returned as BindErrors.
+func ParsePage(r *http.Request, opts PageOptions) (*PageRequest, error) {
+	if opts.DefaultLimit <= 0 {
+		opts.DefaultLimit = DefaultPageLimit
+	}
+	if opts.MaxLimit <= 0 {
+		opts.MaxLimit = MaxPageLimit
+	}
+
+	var (
+		query = r.URL.Query()
+		page  = &PageRequest{Limit: opts.DefaultLimit}
+		errs  BindErrors
+	)
+	invalid := func(name, value string, err error) {
+		errs = append(errs, &BindError{Source: SourceQuery, Name: name, Value: value, Err: err})
+	}
+
+	if v := query.Get(QueryLimit); v != "" {
+		limit, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			invalid(QueryLimit, v, convertError(v, reflect.TypeOf(0)))
+		case limit < 1 || limit > opts.MaxLimit:
+			invalid(QueryLimit, v, fmt.Errorf("must be between 1 and %d", opts.MaxLimit))
+		default:
+			page.Limit = limit
+		}
+	}
+	if v := query.Get(QueryOffset); v != "" {
+		offset, err := strconv.Atoi(v)
+		switch {
+		case err != nil:
+			invalid(QueryOffset, v, convertError(v, reflect.TypeOf(0)))
+		case offset < 0:
+			invalid(QueryOffset, v, errors.New("must not be negative"))
+		default:
+			page.Offset = offset
+		}
+	}
+	if v := query.Get(QueryCursor); v != "" {
+		if opts.Cursor != nil {
+			if err := opts.Cursor.Decode(v, new(json.RawMessage)); err != nil {
+				invalid(QueryCursor, v, err)
+			}
+		}
+		page.Cursor = v
+	}
+	if page.Cursor != "" && page.Offset > 0 {
+		invalid(QueryOffset, query.Get(QueryOffset), errors.New("cannot be used with cursor"))
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return page, nil
+}
+
+// Page is the standard envelope of a list response.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of all items, omitted if unknown.
+	Total      *int64 `json:"total,omitempty"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// WritePage writes the page with the RFC 8288 Link header of the next and the previous page.
+// Pages with cursors link by the cursor parameter, other pages by the offset parameter.
+func WritePage[T any](w http.ResponseWriter, r *http.Request, req *PageRequest, page *Page[T]) {
+	WritePageWith(DefaultResponder, w, r, req, page)
+}
+
+// WritePageWith writes the page like WritePage, encoded by the responder.
+func WritePageWith[T any](rs *Responder, w http.ResponseWriter, r *http.Request, req *PageRequest, page *Page[T]) {
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+
+	var links []string
+	if page.NextCursor != "" || page.PrevCursor != "" {
+		if page.NextCursor != "" {
+			links = append(links, pageLink(r, "next", QueryCursor, page.NextCursor))
+		}
+		if page.PrevCursor != "" {
+			links = append(links, pageLink(r, "prev", QueryCursor, page.PrevCursor))
+		}
+	} else if req != nil {
+		next := req.Offset + len(page.Items)
+		hasNext := len(page.Items) >= req.Limit
+		if page.Total != nil {
+			hasNext = int64(next) < *page.Total
+		}
+		if hasNext && len(page.Items) > 0 {
+			links = append(links, pageLink(r, "next", QueryOffset, strconv.Itoa(next)))
+		}
+		if req.Offset > 0 {
+			prev := req.Offset - req.Limit
+			if prev < 0 {
+				prev = 0
+			}
+			links = append(links, pageLink(r, "prev", QueryOffset, strconv.Itoa(prev)))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	rs.OK(w, page)
+}
+
+func pageLink(r *http.Request, rel, key, value string) string {
+	query := r.URL.Query()
+	query.Del(QueryOffset)
+	query.Del(QueryCursor)
+	query.Set(key, value)
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
+
+// CursorCodec encodes cursors into opaque tokens signed by HMAC-SHA256,
+// so that clients cannot forge or tamper with them.
+type CursorCodec struct {
+	key []byte
+}
+
+// MinCursorKeySize is the minimum size of the key of a CursorCodec in bytes.
+const MinCursorKeySize = 32
+
+// NewCursorCodec returns a CursorCodec signing with the secret key,
+// it fails if the key is shorter than MinCursorKeySize.
+func NewCursorCodec(key []byte) (*CursorCodec, error) {
+	if len(key) < MinCursorKeySize {
+		return nil, fmt.Errorf("ctr: cursor key must be at least %d bytes", MinCursorKeySize)
+	}
+	return &CursorCodec{key: append([]byte(nil), key...)}, nil
+}
+
+// MustNewCursorCodec is like NewCursorCodec but panics if the key is invalid,
+// it is meant for keys which are fixed at startup.
+func MustNewCursorCodec(key []byte) *CursorCodec {
+	c, err := NewCursorCodec(key)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// Encode encodes v as json into a signed token.
+func (c *CursorCodec) Encode(v any) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." +
+		base64.RawURLEncoding.EncodeToString(c.sign(payload)), nil
+}
+
+// Decode verifies the token and decodes it into v, it fails with ErrInvalidCursor.
+func (c *CursorCodec) Decode(token string, v any) error {
+	data, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(mac, c.sign(payload)) {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+func (c *CursorCodec) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, c.key)
+	h.Write(payload)
+	return h.Sum(nil)
+}
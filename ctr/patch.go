@@ -0,0 +1,527 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+)
+
+// MaxPatchSize is the maximum size of the patch documents read by ApplyMergePatch and ApplyJSONPatch
+// in bytes, a larger patch fails with *BodyTooLargeError.
+var MaxPatchSize int64 = 1 << 20
+
+var (
+	// ErrInvalidPatch is the error of a malformed patch document.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrPatchTestFailed is the error of a failed test operation.
+	ErrPatchTestFailed = errors.New("test failed")
+)
+
+// PatchError is the error of applying a patch.
+type PatchError struct {
+	// Index is the index of the failed operation of a JSON Patch, -1 if not applicable.
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *PatchError) Error() string {
+	if e.Index < 0 {
+		return "patch failed: " + e.Err.Error()
+	}
+	return fmt.Sprintf("patch operation %d (%s %q) failed: %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *PatchError) Unwrap() error {
+	return e.Err
+}
+
+// Problem returns a 400 problem for malformed patches, a 409 problem for failed tests
+// and a 422 problem for patches which cannot be applied, with the operation members.
+func (e *PatchError) Problem() *Problem {
+	status := http.StatusUnprocessableEntity
+	switch {
+	case errors.Is(e.Err, ErrInvalidPatch):
+		status = http.StatusBadRequest
+	case errors.Is(e.Err, ErrPatchTestFailed):
+		status = http.StatusConflict
+	}
+	p := NewProblem(status, e.Error())
+	if e.Index >= 0 {
+		p.With("operation", e.Index).With("op", e.Op).With("path", e.Path)
+	}
+	return p
+}
+
+// DecodePatch applies the patch in the request body to the value pointed to by v,
+// as a merge patch or a JSON Patch by the Content-Type, then validates it.
+// Other content types fail with a 415 problem.
+func DecodePatch(r *http.Request, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case MIMEMergePatch:
+		return ApplyMergePatch(r.Body, v)
+	case MIMEJSONPatch:
+		return ApplyJSONPatch(r.Body, v)
+	}
+	return NewProblem(http.StatusUnsupportedMediaType, "unsupported patch type "+strconv.Quote(mediaType)).
+		With("accept", []string{MIMEMergePatch, MIMEJSONPatch})
+}
+
+// ApplyMergePatch applies the RFC 7396 merge patch read from r to the value pointed to by v,
+// then validates it by ValidateStruct and the Validator hook.
+func ApplyMergePatch(r io.Reader, v any) error {
+	patch, err := readPatch(r)
+	if err != nil {
+		return err
+	}
+	return applyPatch(v, func(doc []byte) ([]byte, error) {
+		return MergePatch(doc, patch)
+	})
+}
+
+// ApplyJSONPatch applies the RFC 6902 JSON Patch read from r to the value pointed to by v,
+// then validates it by ValidateStruct and the Validator hook.
+func ApplyJSONPatch(r io.Reader, v any) error {
+	patch, err := readPatch(r)
+	if err != nil {
+		return err
+	}
+	return applyPatch(v, func(doc []byte) ([]byte, error) {
+		return JSONPatch(doc, patch)
+	})
+}
+
+// readPatch reads the patch document up to MaxPatchSize,
+// the error of http.MaxBytesReader is reported as *BodyTooLargeError as well.
+func readPatch(r io.Reader) ([]byte, error) {
+	patch, err := io.ReadAll(&limitedReader{r: r, n: MaxPatchSize, limit: MaxPatchSize})
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, &BodyTooLargeError{Limit: maxBytesErr.Limit}
+	}
+	return patch, err
+}
+
+// applyPatch patches the json document of v and decodes the result back into v.
+// The top-level fields which are not encoded to json keep their values.
+func applyPatch(v any, patch func(doc []byte) ([]byte, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("patch target must be a non-nil pointer")
+	}
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	out, err := patch(doc)
+	if err != nil {
+		return err
+	}
+
+	target := reflect.New(rv.Elem().Type())
+	if elem := target.Elem(); elem.Kind() == reflect.Struct {
+		elem.Set(rv.Elem())
+		resetJSONFields(elem)
+	}
+	if err := json.Unmarshal(out, target.Interface()); err != nil {
+		return &PatchError{Index: -1, Err: fmt.Errorf("patched document does not match the target: %w", err)}
+	}
+	rv.Elem().Set(target.Elem())
+	return validate(v)
+}
+
+func resetJSONFields(rv reflect.Value) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		if fv := rv.Field(i); fv.CanSet() && field.Tag.Get("json") != "-" {
+			fv.Set(reflect.Zero(field.Type))
+		}
+	}
+}
+
+// MergePatch applies the RFC 7396 merge patch to the json document.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	p, err := unmarshalPatch(patch)
+	if err != nil {
+		return nil, &PatchError{Index: -1, Err: fmt.Errorf("%w: %v", ErrInvalidPatch, err)}
+	}
+	var target any
+	if len(bytes.TrimSpace(doc)) > 0 {
+		if target, err = unmarshalPatch(doc); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch any) any {
+	pm, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	tm, ok := target.(map[string]any)
+	if !ok {
+		tm = make(map[string]any, len(pm))
+	}
+	for key, value := range pm {
+		if value == nil {
+			delete(tm, key)
+			continue
+		}
+		tm[key] = mergePatch(tm[key], value)
+	}
+	return tm
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies the RFC 6902 JSON Patch to the json document.
+// The operations are applied in order, and the first failure is returned as *PatchError.
+func JSONPatch(doc, patch []byte) ([]byte, error) {
+	var ops []patchOperation
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, &PatchError{Index: -1, Err: fmt.Errorf("%w: %v", ErrInvalidPatch, err)}
+	}
+	target, err := unmarshalPatch(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		path := ""
+		if op.Path != nil {
+			path = *op.Path
+		}
+		target, err = applyOperation(target, op)
+		if err != nil {
+			return nil, &PatchError{Index: i, Op: op.Op, Path: path, Err: err}
+		}
+	}
+	return json.Marshal(target)
+}
+
+func applyOperation(doc any, op patchOperation) (any, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	switch op.Op {
+	case "add", "replace", "test":
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		if value, err = unmarshalPatch(op.Value); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = getPointer(doc, from); err != nil {
+			return nil, fmt.Errorf("from %q: %w", *op.From, err)
+		}
+		if op.Op == "move" {
+			if *op.Path != *op.From && strings.HasPrefix(*op.Path, *op.From+"/") {
+				return nil, fmt.Errorf("cannot move %q into its own child", *op.From)
+			}
+			if doc, err = removePointer(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+	case "remove":
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+
+	switch op.Op {
+	case "add", "move", "copy":
+		return addPointer(doc, path, value)
+	case "remove":
+		return removePointer(doc, path)
+	case "replace":
+		if _, err := getPointer(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return value, nil
+		}
+		if doc, err = removePointer(doc, path); err != nil {
+			return nil, err
+		}
+		return addPointer(doc, path, value)
+	default: // test
+		current, err := getPointer(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, ErrPatchTestFailed
+		}
+		return doc, nil
+	}
+}
+
+func unmarshalPatch(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parsePointer parses the RFC 6901 json pointer into its reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: pointer %q must start with /", ErrInvalidPatch, pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getPointer(doc any, path []string) (any, error) {
+	node := doc
+	for i, token := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("member %q not found at %s", token, formatPointer(path[:i]))
+			}
+			node = child
+		case []any:
+			idx, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, fmt.Errorf("%v at %s", err, formatPointer(path[:i]))
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("cannot traverse into a scalar at %s", formatPointer(path[:i]))
+		}
+	}
+	return node, nil
+}
+
+// updateParent calls fn with the parent container of the path and the last token,
+// and stores the container returned by fn in place of the parent.
+func updateParent(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	token := path[0]
+	switch n := doc.(type) {
+	case map[string]any:
+		child, ok := n[token]
+		if !ok {
+			return nil, fmt.Errorf("member %q not found", token)
+		}
+		updated, err := updateParent(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []any:
+		idx, err := arrayIndex(token, len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := updateParent(n[idx], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[idx] = updated
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot traverse into a scalar at %q", token)
+}
+
+func addPointer(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			n[token] = value
+			return n, nil
+		case []any:
+			if token == "-" {
+				return append(n, value), nil
+			}
+			idx, err := arrayIndex(token, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[idx+1:], n[idx:])
+			n[idx] = value
+			return n, nil
+		}
+		return nil, fmt.Errorf("cannot add member %q to a scalar", token)
+	})
+}
+
+func removePointer(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, errors.New("cannot remove the whole document")
+	}
+	return updateParent(doc, path, func(parent any, token string) (any, error) {
+		switch n := parent.(type) {
+		case map[string]any:
+			if _, ok := n[token]; !ok {
+				return nil, fmt.Errorf("member %q not found", token)
+			}
+			delete(n, token)
+			return n, nil
+		case []any:
+			idx, err := arrayIndex(token, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:idx], n[idx+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove member %q from a scalar", token)
+	})
+}
+
+// arrayIndex parses the array index token, which must be within 0 and last.
+func arrayIndex(token string, last int) (int, error) {
+	if token == "-" {
+		return 0, errors.New("index - refers to the end of the array")
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil || idx < 0 {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if idx > last {
+		return 0, fmt.Errorf("array index %d out of bounds", idx)
+	}
+	return idx, nil
+}
+
+func formatPointer(tokens []string) string {
+	if len(tokens) == 0 {
+		return `""`
+	}
+	var b strings.Builder
+	for _, token := range tokens {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1"))
+	}
+	return strconv.Quote(b.String())
+}
+
+func deepCopy(v any) any {
+	switch vv := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(vv))
+		for k, item := range vv {
+			out[k] = deepCopy(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(vv))
+		for i, item := range vv {
+			out[i] = deepCopy(item)
+		}
+		return out
+	}
+	return v
+}
+
+// jsonEqual compares the json values, numbers by their value.
+func jsonEqual(a, b any) bool {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		af, err1 := av.Float64()
+		bf, err2 := bv.Float64()
+		return err1 == nil && err2 == nil && af == bf
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for k, item := range av {
+			other, ok := bv[k]
+			if !ok || !jsonEqual(item, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		bv, ok := b.([]any)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !jsonEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
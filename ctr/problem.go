@@ -0,0 +1,186 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+const MIMEProblemJSON = "application/problem+json"
+
+// Problem is the problem details of an HTTP API error defined by RFC 7807.
+// It implements error, so it can be returned and wrapped like any other error.
+type Problem struct {
+	// Type is a URI reference that identifies the problem type, "about:blank" if empty.
+	Type string
+	// Title is a short, human-readable summary of the problem type.
+	Title string
+	// Status is the HTTP status code of the problem.
+	Status int
+	// Detail is a human-readable explanation specific to this occurrence of the problem.
+	Detail string
+	// Instance is a URI reference that identifies the specific occurrence of the problem.
+	Instance string
+	// Extensions are the additional members of the problem.
+	Extensions map[string]any
+}
+
+// ProblemDetailer is implemented by errors which carry problem details.
+type ProblemDetailer interface {
+	Problem() *Problem
+}
+
+// NewProblem returns a problem of the status with the detail,
+// the title is the text of the status code.
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With sets the extension member of the problem.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+// Problem returns the problem itself, which implements ProblemDetailer.
+func (p *Problem) Problem() *Problem {
+	return p
+}
+
+func (p *Problem) Error() string {
+	title := p.Title
+	if title == "" {
+		title = http.StatusText(p.Status)
+	}
+	if p.Detail == "" {
+		return title
+	}
+	if title == "" {
+		return p.Detail
+	}
+	return title + ": " + p.Detail
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	if p.Type != "" {
+		m["type"] = p.Type
+	}
+	if p.Title != "" {
+		m["title"] = p.Title
+	}
+	if p.Status != 0 {
+		m["status"] = p.Status
+	}
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return json.Marshal(m)
+}
+
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+
+	out := Problem{}
+	members := map[string]any{
+		"type":     &out.Type,
+		"title":    &out.Title,
+		"status":   &out.Status,
+		"detail":   &out.Detail,
+		"instance": &out.Instance,
+	}
+	for k, raw := range m {
+		if member, ok := members[k]; ok {
+			if err := json.Unmarshal(raw, member); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		if out.Extensions == nil {
+			out.Extensions = make(map[string]any)
+		}
+		out.Extensions[k] = v
+	}
+	*p = out
+	return nil
+}
+
+// AsProblem returns the problem details carried by v,
+// which is either a *Problem or an error wrapping a ProblemDetailer.
+func AsProblem(v any) (*Problem, bool) {
+	switch vv := v.(type) {
+	case *Problem:
+		return vv, vv != nil
+	case ProblemDetailer:
+		p := vv.Problem()
+		return p, p != nil
+	case error:
+		var pd ProblemDetailer
+		if errors.As(vv, &pd) {
+			p := pd.Problem()
+			return p, p != nil
+		}
+	}
+	return nil, false
+}
+
+// ProblemJSON writes the problem to the response as application/problem+json
+// with the status code of the problem, 500 if it is not set.
+func ProblemJSON(w http.ResponseWriter, p *Problem) {
+	status := p.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	w.Header().Set("Content-Type", MIMEProblemJSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+// withStatus returns a copy of the problem with the status and its default title
+// if the problem has no status, the status of the problem takes precedence otherwise.
+func (p *Problem) withStatus(status int) *Problem {
+	out := *p
+	if out.Status != 0 {
+		return &out
+	}
+	out.Status = status
+	if out.Title == "" {
+		out.Title = http.StatusText(status)
+	}
+	return &out
+}
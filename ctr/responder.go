@@ -0,0 +1,141 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import "io"
+
+// DefaultResponder is used by the package functions, e.g. OK, Error and Decode.
+var DefaultResponder = NewResponder()
+
+// Responder writes responses and decodes requests with its own decoder, encoder,
+// error hook, logger, error envelope and error registry, so that different
+// services in one binary can be configured separately.
+// It should be configured before use, the setters are not safe for concurrent use.
+type Responder struct {
+	decoder  func(r io.Reader, v any) error
+	encoder  EncodeFunc
+	hook     func(vs ...any) any
+	logger   LevelLog
+	envelope func(status int, message string) any
+	registry *ErrorRegistry
+}
+
+// NewResponder returns a Responder which uses DefaultDecoder, the json encoder,
+// no error hook, no logger, plain message errors and DefaultErrorRegistry.
+func NewResponder() *Responder {
+	return &Responder{
+		encoder: encodeJSON,
+		logger:  new(emptyLogger),
+	}
+}
+
+// SetDecoder sets the decoder of request bodies, nil means DefaultDecoder.
+func (rs *Responder) SetDecoder(decoder func(r io.Reader, v any) error) {
+	rs.decoder = decoder
+}
+
+// SetEncoder sets the encoder of json responses.
+func (rs *Responder) SetEncoder(encoder EncodeFunc) {
+	if encoder != nil {
+		rs.encoder = encoder
+	}
+}
+
+// HookError sets the hook which processes the error values before they are written.
+func (rs *Responder) HookError(hook func(vs ...any) any) {
+	rs.hook = hook
+}
+
+// RunHookError runs the error hook, it returns the first value without a hook.
+func (rs *Responder) RunHookError(vs ...any) any {
+	if rs.hook != nil {
+		return rs.hook(vs...)
+	}
+	if len(vs) > 0 {
+		return vs[0]
+	}
+	return nil
+}
+
+// SetLog sets the logger of the responder, which only logs the error messages.
+// The fields are only passed to a KVLog covered by CoverKVLog.
+func (rs *Responder) SetLog(l Log) {
+	switch v := l.(type) {
+	case nil:
+	case *coverLog:
+		rs.logger = FromKVLog(v.logger)
+	case *errorLog:
+		rs.logger = v.logger
+	default:
+		rs.logger = &legacyLog{logger: l}
+	}
+}
+
+// Logger returns the logger of the responder as Log.
+func (rs *Responder) Logger() Log {
+	if l, ok := rs.logger.(*legacyLog); ok {
+		return l.logger
+	}
+	return &errorLog{logger: rs.logger}
+}
+
+// SetLevelLog sets the levelled logger of the responder.
+func (rs *Responder) SetLevelLog(l LevelLog) {
+	if l != nil {
+		rs.logger = l
+	}
+}
+
+// LevelLogger returns the levelled logger of the responder.
+func (rs *Responder) LevelLogger() LevelLog {
+	return rs.logger
+}
+
+// SetErrorEnvelope sets the builder of the body of error responses,
+// nil means the message is written as a json string.
+// Problem details are written as they are.
+//
+//	rs.SetErrorEnvelope(func(status int, message string) any {
+//		return map[string]any{"code": status, "message": message}
+//	})
+func (rs *Responder) SetErrorEnvelope(envelope func(status int, message string) any) {
+	rs.envelope = envelope
+}
+
+// SetErrorRegistry sets the registry used by Error, nil means DefaultErrorRegistry.
+func (rs *Responder) SetErrorRegistry(registry *ErrorRegistry) {
+	rs.registry = registry
+}
+
+func (rs *Responder) decode(r io.Reader, v any) error {
+	if rs.decoder != nil {
+		return rs.decoder(r, v)
+	}
+	return DefaultDecoder(r, v)
+}
+
+func (rs *Responder) errorBody(status int, message string) any {
+	if rs.envelope != nil {
+		return rs.envelope(status, message)
+	}
+	return message
+}
+
+func (rs *Responder) errorRegistry() *ErrorRegistry {
+	if rs.registry != nil {
+		return rs.registry
+	}
+	return DefaultErrorRegistry
+}
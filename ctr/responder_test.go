@@ -0,0 +1,122 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestResponder returns a responder which marks its error envelopes and encoded values with the name.
+func newTestResponder(name string) *Responder {
+	rs := NewResponder()
+	rs.SetErrorEnvelope(func(status int, message string) any {
+		return map[string]any{"responder": name, "status": status, "message": message}
+	})
+	rs.SetEncoder(func(w io.Writer, v any) error {
+		return json.NewEncoder(w).Encode(map[string]any{"responder": name, "data": v})
+	})
+	return rs
+}
+
+func responderOf(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var body struct {
+		Responder string `json:"responder"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", rec.Body.String(), err)
+	}
+	return body.Responder
+}
+
+func TestResponderPaths(t *testing.T) {
+	errStream := errors.New("stream failed")
+	paths := []struct {
+		name   string
+		status int
+		write  func(rs *Responder, w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name:   "negotiate not acceptable",
+			status: http.StatusNotAcceptable,
+			write: func(rs *Responder, w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("Accept", "image/png")
+				rs.NegotiateOK(w, r, "ok")
+			},
+		},
+		{
+			name:   "negotiator encode error",
+			status: http.StatusInternalServerError,
+			write: func(rs *Responder, w http.ResponseWriter, r *http.Request) {
+				r.Header.Set("Accept", MIMEJSON)
+				NewNegotiator().WriteWith(rs, w, r, make(chan int), http.StatusOK)
+			},
+		},
+		{
+			name:   "ndjson error",
+			status: http.StatusInternalServerError,
+			write: func(rs *Responder, w http.ResponseWriter, r *http.Request) {
+				seq := func(yield func(int) error) error { return errStream }
+				_ = NDJSONWith[int](rs, w, r, seq, StreamOptions{})
+			},
+		},
+		{
+			name:   "csv error",
+			status: http.StatusInternalServerError,
+			write: func(rs *Responder, w http.ResponseWriter, r *http.Request) {
+				seq := func(yield func([]string) error) error { return errStream }
+				_ = rs.CSV(w, r, nil, seq, StreamOptions{})
+			},
+		},
+		{
+			name:   "page",
+			status: http.StatusOK,
+			write: func(rs *Responder, w http.ResponseWriter, r *http.Request) {
+				WritePageWith(rs, w, r, &PageRequest{Limit: 1}, &Page[int]{Items: []int{1}})
+			},
+		},
+	}
+
+	for _, path := range paths {
+		path := path
+		for _, name := range []string{"first", "second"} {
+			name := name
+			rs := newTestResponder(name)
+			t.Run(fmt.Sprintf("%s/%s", path.name, name), func(t *testing.T) {
+				t.Parallel()
+				for i := 0; i < 20; i++ {
+					rec := httptest.NewRecorder()
+					path.write(rs, rec, httptest.NewRequest(http.MethodGet, "/", nil))
+					if rec.Code != path.status {
+						t.Fatalf("status %d, want %d", rec.Code, path.status)
+					}
+					if got := responderOf(t, rec); got != name {
+						t.Fatalf("written by responder %q, want %q", got, name)
+					}
+					if strings.Contains(rec.Body.String(), errStream.Error()) {
+						t.Fatal("the internal error is exposed")
+					}
+				}
+			})
+		}
+	}
+}
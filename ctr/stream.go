@@ -0,0 +1,235 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	MIMENDJSON = "application/x-ndjson"
+	MIMECSV    = "text/csv"
+)
+
+// DefaultFlushInterval is the flush interval of the streaming writers if unset.
+const DefaultFlushInterval = time.Second
+
+// Iterator is a push iterator which calls yield for every item in order,
+// it must stop and return the error once yield returns an error.
+type Iterator[T any] func(yield func(T) error) error
+
+// FromSlice returns an Iterator over the items of the slice.
+func FromSlice[T any](items []T) Iterator[T] {
+	return func(yield func(T) error) error {
+		for _, item := range items {
+			if err := yield(item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// FromChan returns an Iterator over the items received from the channel until it is closed,
+// it stops with the context error once the context is done, usually the request context.
+// The channel is no longer drained once the stream stops, so the sender should watch the context as well.
+func FromChan[T any](ctx context.Context, ch <-chan T) Iterator[T] {
+	return func(yield func(T) error) error {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case item, ok := <-ch:
+				if !ok {
+					return nil
+				}
+				if err := yield(item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// StreamOptions defines the options of the streaming writers.
+type StreamOptions struct {
+	// Filename sets the Content-Disposition header as an attachment if not empty.
+	Filename string
+	// FlushInterval is the longest time written items stay buffered, DefaultFlushInterval if 0.
+	FlushInterval time.Duration
+}
+
+// NDJSON streams the items as newline-delimited json to the response.
+// It stops with the context error when the client disconnects.
+// If the iterator fails before anything is written, the error is written by Error,
+// otherwise the response is cut short and the error is only returned.
+func NDJSON[T any](w http.ResponseWriter, r *http.Request, seq Iterator[T], opts StreamOptions) error {
+	return NDJSONWith(DefaultResponder, w, r, seq, opts)
+}
+
+// NDJSONWith streams the items like NDJSON, the error before anything is written is written by the responder.
+func NDJSONWith[T any](rs *Responder, w http.ResponseWriter, r *http.Request, seq Iterator[T], opts StreamOptions) error {
+	return stream(rs, w, r, MIMENDJSON, opts, func(sw *streamWriter) error {
+		enc := json.NewEncoder(sw)
+		return seq(func(item T) error {
+			if err := sw.check(); err != nil {
+				return err
+			}
+			return enc.Encode(item)
+		})
+	})
+}
+
+// CSV streams the header, if any, and the records as csv to the response.
+// It stops and reports errors in the same way as NDJSON.
+func CSV(w http.ResponseWriter, r *http.Request, header []string, seq Iterator[[]string], opts StreamOptions) error {
+	return DefaultResponder.CSV(w, r, header, seq, opts)
+}
+
+// CSV streams the header, if any, and the records as csv to the response,
+// the error before anything is written is written by the responder.
+func (rs *Responder) CSV(w http.ResponseWriter, r *http.Request, header []string, seq Iterator[[]string], opts StreamOptions) error {
+	return stream(rs, w, r, MIMECSV+"; charset=utf-8", opts, func(sw *streamWriter) error {
+		cw := csv.NewWriter(sw)
+		write := func(record []string) error {
+			if err := sw.check(); err != nil {
+				return err
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+			// Hand the record over to the buffer of the stream so that it is flushed in time.
+			cw.Flush()
+			return cw.Error()
+		}
+
+		if len(header) > 0 {
+			if err := write(header); err != nil {
+				return err
+			}
+		}
+		return seq(write)
+	})
+}
+
+func stream(rs *Responder, w http.ResponseWriter, r *http.Request, contentType string, opts StreamOptions, fn func(sw *streamWriter) error) error {
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if opts.Filename != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": opts.Filename,
+		}))
+	}
+
+	sw := &streamWriter{r: r, w: w, out: startWriter{w: w}}
+	sw.buf = bufio.NewWriter(&sw.out)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(opts.FlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_ = sw.Flush()
+			}
+		}
+	}()
+
+	err := fn(sw)
+	close(done)
+	<-stopped
+	if err != nil && !sw.started() {
+		if r.Context().Err() == nil {
+			header.Del("Content-Disposition")
+			rs.Error(w, err)
+		}
+		return err
+	}
+	if flushErr := sw.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// streamWriter buffers the items and flushes them to the response
+// periodically, which is safe for use by the flushing goroutine.
+type streamWriter struct {
+	r *http.Request
+	w http.ResponseWriter
+
+	mu  sync.Mutex
+	buf *bufio.Writer
+	out startWriter
+}
+
+// check reports the context error once the client disconnects.
+func (sw *streamWriter) check() error {
+	return sw.r.Context().Err()
+}
+
+func (sw *streamWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.buf.Write(p)
+}
+
+func (sw *streamWriter) started() bool {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.out.written
+}
+
+func (sw *streamWriter) Flush() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.buf.Buffered() == 0 {
+		return nil
+	}
+	if err := sw.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := sw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// startWriter records whether anything has been written to the response.
+type startWriter struct {
+	w       http.ResponseWriter
+	written bool
+}
+
+func (s *startWriter) Write(p []byte) (int, error) {
+	s.written = true
+	return s.w.Write(p)
+}
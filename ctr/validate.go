@@ -0,0 +1,477 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ValidateTag is the struct tag holding the validation rules of a field, e.g.
+//
+//	type CreateUserRequest struct {
+//		Name  string `json:"name" validate:"required,min=1,max=64"`
+//		Role  string `json:"role" validate:"oneof=admin member"`
+//		Email string `json:"email" validate:"omitempty,email"`
+//	}
+//
+// The built-in rules are required, omitempty, min, max, len, oneof, email, url and uuid.
+// min, max and len compare the length of strings, slices and maps, and the value of numbers.
+// Other rules must be added by RegisterRule, the rules after dive are skipped.
+// A tag with an unknown rule, or a rule which does not fit its parameter or the field type,
+// is a bug of the struct and panics when it is validated.
+const ValidateTag = "validate"
+
+// ErrInvalidRule is wrapped by the errors of a rule which is misused by the tag,
+// e.g. min with a parameter which is not a number.
+var ErrInvalidRule = errors.New("invalid validation rule")
+
+// RuleFunc checks the value of a field against the rule parameter,
+// the returned error message is reported for the field.
+// An error wrapping ErrInvalidRule is not a violation, but a bug of the tag.
+type RuleFunc func(v reflect.Value, param string) error
+
+var rules = map[string]RuleFunc{
+	"required": ruleRequired,
+	"min":      ruleMin,
+	"max":      ruleMax,
+	"len":      ruleLen,
+	"oneof":    ruleOneOf,
+	"email":    ruleEmail,
+	"url":      ruleURL,
+	"uuid":     ruleUUID,
+}
+
+var (
+	rulesMu sync.RWMutex
+	// structRulesCache holds the parsed rules of the struct types, guarded by rulesMu.
+	structRulesCache = make(map[reflect.Type][]fieldRules)
+)
+
+// RegisterRule adds a custom validation rule which can be used in ValidateTag.
+func RegisterRule(name string, fn RuleFunc) {
+	if name == "" || strings.ContainsAny(name, ",= ") {
+		panic("ctr: invalid validation rule name " + strconv.Quote(name))
+	}
+	if name == "omitempty" || name == "dive" {
+		panic("ctr: validation rule " + name + " cannot be replaced")
+	}
+	if fn == nil {
+		panic("ctr: validation rule " + name + " must be defined")
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rules[name] = fn
+	structRulesCache = make(map[reflect.Type][]fieldRules)
+}
+
+// FieldError is the violation of a rule by a field.
+type FieldError struct {
+	// Field is the path of the field named by its json name, e.g. items[0].name.
+	Field   string
+	Rule    string
+	Param   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// ValidationErrors are the violations of all fields.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Problem returns a 400 problem with the breakdown of every field in the errors member.
+func (e ValidationErrors) Problem() *Problem {
+	items := make([]map[string]any, 0, len(e))
+	for _, err := range e {
+		items = append(items, map[string]any{
+			"field":  err.Field,
+			"rule":   err.Rule,
+			"detail": err.Message,
+		})
+	}
+	return NewProblem(http.StatusBadRequest, e.Error()).With("errors", items)
+}
+
+// ValidateStruct checks the fields of the struct against their ValidateTag rules,
+// nested structs, pointers and slices of structs are checked as well.
+// All violations are returned as ValidationErrors.
+func ValidateStruct(v any) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+
+	vs := &validation{visited: make(map[visit]bool)}
+	vs.validateStruct(rv, "")
+	if len(vs.errs) > 0 {
+		return vs.errs
+	}
+	return nil
+}
+
+type fieldRules struct {
+	index     int
+	name      string
+	embedded  bool
+	omitempty bool
+	rules     []fieldRule
+}
+
+type fieldRule struct {
+	name  string
+	param string
+	fn    RuleFunc
+}
+
+// structRules returns the rules of the fields of the struct type, parsed on first use.
+// It panics on unknown rules. The rules after dive, which apply to the items of a collection, are skipped.
+func structRules(t reflect.Type) []fieldRules {
+	rulesMu.RLock()
+	out, ok := structRulesCache[t]
+	rulesMu.RUnlock()
+	if ok {
+		return out
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	if out, ok := structRulesCache[t]; ok {
+		return out
+	}
+	out = parseStructRules(t)
+	structRulesCache[t] = out
+	return out
+}
+
+func parseStructRules(t reflect.Type) []fieldRules {
+	out := make([]fieldRules, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fr := fieldRules{index: i, name: fieldName(field), embedded: field.Anonymous}
+		if tag := field.Tag.Get(ValidateTag); tag != "" && tag != "-" {
+			for _, item := range strings.Split(tag, ",") {
+				name, param, _ := strings.Cut(strings.TrimSpace(item), "=")
+				if name == "dive" {
+					break
+				}
+				if name == "omitempty" {
+					fr.omitempty = true
+					continue
+				}
+				fn, ok := rules[name]
+				if !ok {
+					panic(fmt.Sprintf("ctr: unknown validation rule %s of field %s.%s", strconv.Quote(name), t, field.Name))
+				}
+				fr.rules = append(fr.rules, fieldRule{name: name, param: param, fn: fn})
+			}
+		}
+		out = append(out, fr)
+	}
+	return out
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// validation collects the violations and the pointers on the path being checked,
+// so that self-referential values are not walked forever.
+type validation struct {
+	errs    ValidationErrors
+	visited map[visit]bool
+}
+
+type visit struct {
+	ptr uintptr
+	typ reflect.Type
+}
+
+func (vs *validation) validateStruct(rv reflect.Value, prefix string) {
+	for _, fr := range structRules(rv.Type()) {
+		fv := rv.Field(fr.index)
+		path := prefix
+		if !fr.embedded {
+			path = joinPath(prefix, fr.name)
+		}
+
+		if fr.omitempty && isEmpty(fv) {
+			continue
+		}
+		for _, rule := range fr.rules {
+			if err := rule.fn(fv, rule.param); err != nil {
+				if errors.Is(err, ErrInvalidRule) {
+					panic(fmt.Sprintf("ctr: validation rule %s of field %s in %s: %v", rule.name, path, rv.Type(), err))
+				}
+				vs.errs = append(vs.errs, &FieldError{
+					Field:   path,
+					Rule:    rule.name,
+					Param:   rule.param,
+					Message: err.Error(),
+				})
+				break
+			}
+		}
+		vs.validateNested(fv, path)
+	}
+}
+
+func (vs *validation) validateNested(fv reflect.Value, path string) {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return
+		}
+		if fv.Kind() == reflect.Pointer {
+			key := visit{ptr: fv.Pointer(), typ: fv.Type()}
+			if vs.visited[key] {
+				return
+			}
+			vs.visited[key] = true
+			defer delete(vs.visited, key)
+		}
+		fv = fv.Elem()
+	}
+
+	switch fv.Kind() {
+	case reflect.Struct:
+		if fv.Type() != timeType {
+			vs.validateStruct(fv, path)
+		}
+	case reflect.Slice, reflect.Array:
+		elem := fv.Type().Elem()
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			return
+		}
+		for i := 0; i < fv.Len(); i++ {
+			vs.validateNested(fv.Index(i), path+"["+strconv.Itoa(i)+"]")
+		}
+	}
+}
+
+func joinPath(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// indirect returns the value pointed to, ok is false for nil pointers.
+func indirect(v reflect.Value) (reflect.Value, bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false
+		}
+		v = v.Elem()
+	}
+	return v, true
+}
+
+func ruleRequired(v reflect.Value, _ string) error {
+	if isEmpty(v) {
+		return errors.New("is required")
+	}
+	return nil
+}
+
+// compare returns the size of the value compared by min, max and len.
+func compare(v reflect.Value, param string) (size, limit float64, unit string, err error) {
+	limit, err = strconv.ParseFloat(param, 64)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%w: parameter %q is not a number", ErrInvalidRule, param)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return float64(utf8.RuneCountInString(v.String())), limit, " characters", nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), limit, " items", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), limit, "", nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), limit, "", nil
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), limit, "", nil
+	}
+	return 0, 0, "", fmt.Errorf("%w: %s cannot be compared", ErrInvalidRule, v.Kind())
+}
+
+func ruleMin(v reflect.Value, param string) error {
+	v, ok := indirect(v)
+	if !ok {
+		return nil
+	}
+	size, limit, unit, err := compare(v, param)
+	if err != nil {
+		return err
+	}
+	if size < limit {
+		if unit == "" {
+			return fmt.Errorf("must be at least %s", param)
+		}
+		return fmt.Errorf("must have at least %s%s", param, unit)
+	}
+	return nil
+}
+
+func ruleMax(v reflect.Value, param string) error {
+	v, ok := indirect(v)
+	if !ok {
+		return nil
+	}
+	size, limit, unit, err := compare(v, param)
+	if err != nil {
+		return err
+	}
+	if size > limit {
+		if unit == "" {
+			return fmt.Errorf("must be at most %s", param)
+		}
+		return fmt.Errorf("must have at most %s%s", param, unit)
+	}
+	return nil
+}
+
+func ruleLen(v reflect.Value, param string) error {
+	v, ok := indirect(v)
+	if !ok {
+		return nil
+	}
+	size, limit, unit, err := compare(v, param)
+	if err != nil {
+		return err
+	}
+	if size != limit {
+		if unit == "" {
+			return fmt.Errorf("must be %s", param)
+		}
+		return fmt.Errorf("must have exactly %s%s", param, unit)
+	}
+	return nil
+}
+
+func ruleOneOf(v reflect.Value, param string) error {
+	v, ok := indirect(v)
+	if !ok {
+		return nil
+	}
+
+	options := strings.Fields(param)
+	var value string
+	switch v.Kind() {
+	case reflect.String:
+		value = v.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = strconv.FormatUint(v.Uint(), 10)
+	default:
+		return fmt.Errorf("%w: %s cannot be compared", ErrInvalidRule, v.Kind())
+	}
+	for _, option := range options {
+		if value == option {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of [%s]", strings.Join(options, ", "))
+}
+
+func stringValue(v reflect.Value) (string, bool) {
+	v, ok := indirect(v)
+	if !ok || v.Kind() != reflect.String {
+		return "", false
+	}
+	return v.String(), true
+}
+
+func ruleEmail(v reflect.Value, _ string) error {
+	s, ok := stringValue(v)
+	if !ok {
+		return nil
+	}
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Address != s {
+		return errors.New("must be a valid email address")
+	}
+	return nil
+}
+
+func ruleURL(v reflect.Value, _ string) error {
+	s, ok := stringValue(v)
+	if !ok {
+		return nil
+	}
+	u, err := url.ParseRequestURI(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("must be a valid url")
+	}
+	return nil
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func ruleUUID(v reflect.Value, _ string) error {
+	s, ok := stringValue(v)
+	if !ok {
+		return nil
+	}
+	if !uuidRegexp.MatchString(s) {
+		return errors.New("must be a valid uuid")
+	}
+	return nil
+}
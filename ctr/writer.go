@@ -0,0 +1,183 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ctr
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+)
+
+// HeaderRequestID is the header carrying the request ID.
+const HeaderRequestID = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// ContextWithRequestID returns a copy of the context carrying the request ID.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the request ID carried by the context.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// ResponseWriter wraps http.ResponseWriter to record the status and the size of the response,
+// the errors written through it are logged with the method, path, status and request ID.
+// Pass Writer on to the next handler, so that http.Flusher and http.Hijacker keep working.
+type ResponseWriter struct {
+	http.ResponseWriter
+
+	request *http.Request
+	status  int
+	size    int64
+}
+
+// NewResponseWriter wraps the http.ResponseWriter of the request,
+// it returns the ResponseWriter itself if w is one or its Writer already.
+func NewResponseWriter(w http.ResponseWriter, r *http.Request) *ResponseWriter {
+	if rw, ok := w.(interface{ responseWriter() *ResponseWriter }); ok {
+		return rw.responseWriter()
+	}
+	return &ResponseWriter{ResponseWriter: w, request: r}
+}
+
+// Writer returns the http.ResponseWriter which writes through w,
+// it implements http.Flusher and http.Hijacker only if the wrapped writer does,
+// so that the handlers can still detect whether the response can be streamed or hijacked.
+func (w *ResponseWriter) Writer() http.ResponseWriter {
+	_, flusher := w.ResponseWriter.(http.Flusher)
+	_, hijacker := w.ResponseWriter.(http.Hijacker)
+	switch {
+	case flusher && hijacker:
+		return flushHijackWriter{w}
+	case flusher:
+		return flushWriter{w}
+	case hijacker:
+		return hijackWriter{w}
+	}
+	return w
+}
+
+func (w *ResponseWriter) responseWriter() *ResponseWriter {
+	return w
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Status returns the status of the response, 0 if nothing has been written.
+func (w *ResponseWriter) Status() int {
+	return w.status
+}
+
+// Size returns the number of bytes of the written body.
+func (w *ResponseWriter) Size() int64 {
+	return w.size
+}
+
+// Request returns the request of the response.
+func (w *ResponseWriter) Request() *http.Request {
+	return w.request
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *ResponseWriter) flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *ResponseWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// flushWriter, hijackWriter and flushHijackWriter are the Writer of a ResponseWriter
+// which wraps a flusher, a hijacker or both.
+type flushWriter struct{ *ResponseWriter }
+
+func (w flushWriter) Flush() {
+	w.flush()
+}
+
+type hijackWriter struct{ *ResponseWriter }
+
+func (w hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+type flushHijackWriter struct{ *ResponseWriter }
+
+func (w flushHijackWriter) Flush() {
+	w.flush()
+}
+
+func (w flushHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+// logFields returns the log fields of the response written with the status.
+func logFields(w http.ResponseWriter, status int) []any {
+	rw := findResponseWriter(w)
+	if rw == nil || rw.request == nil {
+		return []any{"status", status}
+	}
+
+	r := rw.request
+	fields := []any{"method", r.Method, "path", r.URL.Path, "status", status}
+	id := RequestIDFromContext(r.Context())
+	if id == "" {
+		id = r.Header.Get(HeaderRequestID)
+	}
+	if id != "" {
+		fields = append(fields, "request_id", id)
+	}
+	return fields
+}
+
+// findResponseWriter returns the ResponseWriter wrapped in w, if any.
+func findResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	for {
+		switch v := w.(type) {
+		case interface{ responseWriter() *ResponseWriter }:
+			return v.responseWriter()
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = v.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/99nil/gopkg/ctr"
+	"github.com/99nil/gopkg/server"
+)
+
+const (
+	PathLive  = "/livez"
+	PathReady = "/readyz"
+)
+
+// DefaultTimeout is the timeout of the checks if unset.
+const DefaultTimeout = 5 * time.Second
+
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFail     = "fail"
+)
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// CheckFunc reports the health of a component, it should return once the context is done.
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named health check of a component.
+type Check struct {
+	Name  string
+	Check CheckFunc
+	// Timeout is the longest time the check can take, DefaultTimeout if 0.
+	Timeout time.Duration
+	// Critical checks fail the endpoint when they fail, other failures only degrade it.
+	Critical bool
+	// Liveness runs the check for /livez as well as /readyz.
+	Liveness bool
+}
+
+// Result is the response of the health endpoints.
+type Result struct {
+	Status string                  `json:"status"`
+	Checks map[string]*CheckResult `json:"checks,omitempty"`
+}
+
+// CheckResult is the result of a single check.
+type CheckResult struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Checker runs the registered checks for the liveness and the readiness endpoints.
+type Checker struct {
+	mu       sync.RWMutex
+	checks   map[string]Check
+	draining atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{checks: make(map[string]Check)}
+}
+
+// Register adds the check, the name must be unique.
+func (c *Checker) Register(check Check) error {
+	if check.Name == "" {
+		return errors.New("health check name is empty")
+	}
+	if check.Check == nil {
+		return fmt.Errorf("health check %q has no check function", check.Name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.checks[check.Name]; ok {
+		return fmt.Errorf("health check %q is already registered", check.Name)
+	}
+	c.checks[check.Name] = check
+	return nil
+}
+
+// Shutdown flips the readiness to failing, so that load balancers stop routing new requests.
+func (c *Checker) Shutdown() {
+	c.draining.Store(true)
+}
+
+// Mux is the router the handlers are mounted on, e.g. *http.ServeMux.
+type Mux interface {
+	Handle(pattern string, handler http.Handler)
+}
+
+// Mount registers the liveness and the readiness handlers at PathLive and PathReady.
+func (c *Checker) Mount(mux Mux) {
+	mux.Handle(PathLive, c.LiveHandler())
+	mux.Handle(PathReady, c.ReadyHandler())
+}
+
+// LiveHandler serves the liveness checks.
+// It replies 200 ok, or 503 service unavailable if a critical check fails.
+// Only the failed checks are listed, all of them with the verbose query parameter.
+func (c *Checker) LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, true)
+	})
+}
+
+// ReadyHandler serves the readiness checks like LiveHandler,
+// it fails regardless of the checks once Shutdown is called.
+func (c *Checker) ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.serve(w, r, false)
+	})
+}
+
+func (c *Checker) serve(w http.ResponseWriter, r *http.Request, live bool) {
+	_, verbose := r.URL.Query()["verbose"]
+	w.Header().Set("Cache-Control", "no-store")
+
+	if !live && c.draining.Load() {
+		ctr.JSON(w, &Result{
+			Status: StatusFail,
+			Checks: map[string]*CheckResult{"shutdown": {
+				Status:   StatusFail,
+				Critical: true,
+				Duration: "0s",
+				Error:    ErrShuttingDown.Error(),
+			}},
+		}, http.StatusServiceUnavailable)
+		return
+	}
+
+	result := c.Run(r.Context(), live)
+	status := http.StatusOK
+	if result.Status == StatusFail {
+		status = http.StatusServiceUnavailable
+	}
+	if !verbose {
+		for name, cr := range result.Checks {
+			if cr.Status == StatusOK {
+				delete(result.Checks, name)
+			}
+		}
+	}
+	ctr.JSON(w, result, status)
+}
+
+// Run runs the liveness checks if live is true, or else all checks, concurrently.
+func (c *Checker) Run(ctx context.Context, live bool) *Result {
+	c.mu.RLock()
+	checks := make([]Check, 0, len(c.checks))
+	for _, check := range c.checks {
+		if !live || check.Liveness {
+			checks = append(checks, check)
+		}
+	}
+	c.mu.RUnlock()
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+
+	results := make([]*CheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i := range checks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, checks[i])
+		}(i)
+	}
+	wg.Wait()
+
+	result := &Result{Status: StatusOK, Checks: make(map[string]*CheckResult, len(checks))}
+	for i, cr := range results {
+		result.Checks[checks[i].Name] = cr
+		if cr.Status == StatusOK {
+			continue
+		}
+		if cr.Critical {
+			result.Status = StatusFail
+		} else if result.Status == StatusOK {
+			result.Status = StatusDegraded
+		}
+	}
+	return result
+}
+
+func runCheck(ctx context.Context, check Check) *CheckResult {
+	timeout := check.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		defer func() {
+			if v := recover(); v != nil {
+				errCh <- fmt.Errorf("panic: %v", v)
+			}
+		}()
+		errCh <- check.Check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", timeout)
+	}
+
+	cr := &CheckResult{
+		Status:   StatusOK,
+		Critical: check.Critical,
+		Duration: time.Since(start).String(),
+	}
+	if err != nil {
+		cr.Status = StatusFail
+		cr.Error = err.Error()
+	}
+	return cr
+}
+
+// WaitForShutdown waits for the context to be done, then flips the readiness to failing
+// and waits for the drain period, so that load balancers stop routing new requests,
+// before the server is shut down by server.WaitForShutdown, e.g.
+//
+//	eg.Go(func() error { return checker.WaitForShutdown(ctx, srv.Server, 10*time.Second, 0) })
+func (c *Checker) WaitForShutdown(ctx context.Context, srv *http.Server, drain, timeout time.Duration) error {
+	<-ctx.Done()
+	c.Shutdown()
+	if drain > 0 {
+		time.Sleep(drain)
+	}
+	return server.WaitForShutdown(ctx, srv, timeout)
+}
@@ -0,0 +1,72 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+// AccessLog logs the method, path, status, bytes and latency of every request
+// to the logger, ctr.LevelLogger() if nil. 5xx responses are logged as errors, others as info.
+// The ResponseWriter is wrapped by ctr.ResponseWriter, whose Writer keeps http.Flusher
+// and http.Hijacker working, so streams such as sse.Sender can be served behind it.
+func AccessLog(logger ctr.LevelLog) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := ctr.NewResponseWriter(w, r)
+			next.ServeHTTP(rw.Writer(), r)
+
+			status := rw.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			fields := []any{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", status,
+				"bytes", rw.Size(),
+				"latency", time.Since(start),
+				"remote_addr", r.RemoteAddr,
+			}
+			if id := requestID(rw, r); id != "" {
+				fields = append(fields, "request_id", id)
+			}
+
+			l := logger
+			if l == nil {
+				l = ctr.LevelLogger()
+			}
+			if status >= http.StatusInternalServerError {
+				l.Error("request", fields...)
+				return
+			}
+			l.Info("request", fields...)
+		})
+	}
+}
+
+func requestID(w http.ResponseWriter, r *http.Request) string {
+	if id := ctr.RequestIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	if id := w.Header().Get(ctr.HeaderRequestID); id != "" {
+		return id
+	}
+	return r.Header.Get(ctr.HeaderRequestID)
+}
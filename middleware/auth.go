@@ -0,0 +1,170 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+// ErrInvalidToken is the error of a bearer token which fails the verification.
+var ErrInvalidToken = errors.New("invalid token")
+
+// AuthOptions defines the options of the auth middlewares.
+type AuthOptions struct {
+	// Realm is the protection space reported in the WWW-Authenticate header.
+	Realm string
+	// Responder writes the 401 responses, ctr.DefaultResponder if nil.
+	Responder *ctr.Responder
+}
+
+func (o *AuthOptions) responder() *ctr.Responder {
+	if o.Responder != nil {
+		return o.Responder
+	}
+	return ctr.DefaultResponder
+}
+
+type userKey struct{}
+
+type claimsKey struct{}
+
+// UserFromContext returns the user authenticated by BasicAuth.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+// ContextWithClaims returns a copy of the context carrying the claims of the bearer token.
+func ContextWithClaims(ctx context.Context, claims any) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// ClaimsFromContext returns the claims of the bearer token verified by BearerAuth, if they are of type T.
+func ClaimsFromContext[T any](ctx context.Context) (T, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(T)
+	return claims, ok
+}
+
+// BasicAuth authenticates the requests by the credentials of the Basic scheme checked by validate,
+// the user is put into the context, see UserFromContext.
+// Failures are replied by Unauthorized with the WWW-Authenticate header.
+func BasicAuth(validate func(user, password string) bool, opts AuthOptions) Middleware {
+	challenge := "Basic realm=" + quoteParam(opts.Realm) + `, charset="UTF-8"`
+	rs := opts.responder()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, password, ok := r.BasicAuth()
+			if !ok || !validate(user, password) {
+				w.Header().Set("WWW-Authenticate", challenge)
+				rs.Unauthorized(w, "invalid credentials")
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+		})
+	}
+}
+
+// BasicAuthUsers returns the validator of BasicAuth checking the users and their passwords,
+// in constant time regardless of the user existing or the length of the password.
+func BasicAuthUsers(users map[string]string) func(user, password string) bool {
+	hashed := make(map[string][32]byte, len(users))
+	for user, password := range users {
+		hashed[user] = sha256.Sum256([]byte(password))
+	}
+	return func(user, password string) bool {
+		expected, ok := hashed[user]
+		actual := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(expected[:], actual[:]) == 1 && ok
+	}
+}
+
+// TokenVerifier verifies bearer tokens and returns their claims.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (any, error)
+}
+
+// TokenVerifierFunc adapts a function to TokenVerifier.
+type TokenVerifierFunc func(ctx context.Context, token string) (any, error)
+
+func (f TokenVerifierFunc) Verify(ctx context.Context, token string) (any, error) {
+	return f(ctx, token)
+}
+
+// BearerAuth authenticates the requests by the bearer token of the Authorization header,
+// checked by the verifier, and puts the claims into the context, see ClaimsFromContext.
+// Failures are replied by Unauthorized with the RFC 6750 WWW-Authenticate header,
+// only the errors wrapping ErrInvalidToken are described to the client.
+func BearerAuth(verifier TokenVerifier, opts AuthOptions) Middleware {
+	rs := opts.responder()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", bearerChallenge(opts.Realm, nil))
+				rs.Unauthorized(w, "missing bearer token")
+				return
+			}
+
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				if !errors.Is(err, ErrInvalidToken) {
+					rs.LevelLogger().Warn("verify bearer token: "+err.Error(), "method", r.Method, "path", r.URL.Path)
+					err = ErrInvalidToken
+				}
+				w.Header().Set("WWW-Authenticate", bearerChallenge(opts.Realm, err))
+				rs.Unauthorized(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ContextWithClaims(r.Context(), claims)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func bearerChallenge(realm string, err error) string {
+	params := []string{}
+	if realm != "" {
+		params = append(params, "realm="+quoteParam(realm))
+	}
+	if err != nil {
+		params = append(params, `error="invalid_token"`, "error_description="+quoteParam(err.Error()))
+	}
+	if len(params) == 0 {
+		return "Bearer"
+	}
+	return "Bearer " + strings.Join(params, ", ")
+}
+
+var paramEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteParam returns the quoted-string of the auth parameter, which only escapes the quote and the backslash.
+func quoteParam(s string) string {
+	return `"` + paramEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,212 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions defines the cross-origin resource sharing policy.
+type CORSOptions struct {
+	// AllowedOrigins are the exact origins, e.g. https://example.com,
+	// the wildcard subdomains, e.g. https://*.example.com, or * for any origin.
+	// * cannot be used with AllowCredentials.
+	AllowedOrigins []string
+	// AllowOriginFunc reports whether the origin is allowed, in addition to AllowedOrigins.
+	AllowOriginFunc func(r *http.Request, origin string) bool
+	// AllowedMethods are the methods allowed by preflights, GET, HEAD and POST if empty.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed by preflights, * allows any header.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to the client.
+	ExposedHeaders []string
+	// AllowCredentials allows the requests with cookies and authorization.
+	AllowCredentials bool
+	// MaxAge is how long the preflight results can be cached, not sent if 0.
+	MaxAge time.Duration
+}
+
+type cors struct {
+	opts           CORSOptions
+	anyOrigin      bool
+	origins        map[string]struct{}
+	wildcards      [][2]string
+	methods        []string
+	headers        map[string]struct{}
+	anyHeader      bool
+	allowedMethods string
+	exposed        string
+}
+
+// CORS handles the cross-origin requests by the options, preflights are answered with 204 no content.
+// Disallowed origins get no CORS headers, so that browsers block them.
+// It panics if * is allowed together with credentials, which would expose the credentials to any site.
+func CORS(opts CORSOptions) Middleware {
+	c := &cors{
+		opts:    opts,
+		origins: make(map[string]struct{}),
+		headers: make(map[string]struct{}),
+	}
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			if opts.AllowCredentials {
+				panic("middleware: CORS cannot allow any origin with credentials")
+			}
+			c.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.origins[origin] = struct{}{}
+		}
+	}
+
+	methods := opts.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+	for _, method := range methods {
+		c.methods = append(c.methods, strings.ToUpper(method))
+	}
+	c.allowedMethods = strings.Join(c.methods, ", ")
+
+	for _, header := range opts.AllowedHeaders {
+		if header == "*" {
+			c.anyHeader = true
+			continue
+		}
+		c.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	c.exposed = strings.Join(opts.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, r)
+				return
+			}
+			c.actual(w, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (c *cors) preflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	defer w.WriteHeader(http.StatusNoContent)
+
+	origin := r.Header.Get("Origin")
+	if !c.allowOrigin(r, origin) {
+		return
+	}
+	if !c.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+		return
+	}
+	requested, ok := c.allowHeaders(r.Header.Values("Access-Control-Request-Headers"))
+	if !ok {
+		return
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", c.allowedMethods)
+	if len(requested) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge/time.Second)))
+	}
+}
+
+func (c *cors) actual(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if !c.allowOrigin(r, origin) {
+		return
+	}
+	c.setOrigin(h, origin)
+	if c.exposed != "" {
+		h.Set("Access-Control-Expose-Headers", c.exposed)
+	}
+}
+
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.opts.AllowCredentials {
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	if c.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+}
+
+func (c *cors) allowOrigin(r *http.Request, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	if c.anyOrigin {
+		return true
+	}
+	lower := strings.ToLower(origin)
+	if _, ok := c.origins[lower]; ok {
+		return true
+	}
+	for _, wc := range c.wildcards {
+		if len(lower) > len(wc[0])+len(wc[1]) && strings.HasPrefix(lower, wc[0]) && strings.HasSuffix(lower, wc[1]) {
+			if sub := lower[len(wc[0]) : len(lower)-len(wc[1])]; !strings.ContainsAny(sub, "/:") {
+				return true
+			}
+		}
+	}
+	return c.opts.AllowOriginFunc != nil && c.opts.AllowOriginFunc(r, origin)
+}
+
+func (c *cors) allowMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders returns the requested headers if all of them are allowed.
+func (c *cors) allowHeaders(values []string) ([]string, bool) {
+	var requested []string
+	for _, value := range values {
+		for _, header := range strings.Split(value, ",") {
+			header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+			if header == "" {
+				continue
+			}
+			if _, ok := c.headers[header]; !ok && !c.anyHeader {
+				return nil, false
+			}
+			requested = append(requested, header)
+		}
+	}
+	return requested, true
+}
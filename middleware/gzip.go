@@ -0,0 +1,354 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+const mimeEventStream = "text/event-stream"
+
+// DefaultGzipMinSize is the minimum size of the compressed responses if unset.
+const DefaultGzipMinSize = 1024
+
+// DefaultMaxDecompressedSize is the decompressed size cap of the request bodies if unset.
+const DefaultMaxDecompressedSize = 32 << 20
+
+// DefaultGzipContentTypes are the media types compressed if unset.
+// text/event-stream is not matched by text/*, as compressing it delays the events,
+// it is only compressed if it is listed as such.
+var DefaultGzipContentTypes = []string{
+	"text/*",
+	ctr.MIMEJSON,
+	ctr.MIMEProblemJSON,
+	ctr.MIMENDJSON,
+	ctr.MIMEXML,
+	"application/javascript",
+	"image/svg+xml",
+}
+
+// GzipOptions defines the options of the response compression.
+type GzipOptions struct {
+	// Level is the compression level, gzip.DefaultCompression if 0.
+	Level int
+	// MinSize is the minimum size of the response in bytes to compress, DefaultGzipMinSize if 0.
+	// Flushed responses are compressed regardless of their size.
+	MinSize int
+	// ContentTypes are the media types to compress, e.g. application/json or text/*,
+	// DefaultGzipContentTypes if empty. Wildcards do not match text/event-stream.
+	ContentTypes []string
+}
+
+// Gzip compresses the responses to the requests accepting gzip by the Accept-Encoding header,
+// if the content type is allowed and the size reaches the threshold.
+// http.Flusher and http.Hijacker keep working through the wrapped writer.
+// It panics if the level is invalid.
+func Gzip(opts GzipOptions) Middleware {
+	if opts.Level == 0 {
+		opts.Level = gzip.DefaultCompression
+	}
+	if opts.MinSize <= 0 {
+		opts.MinSize = DefaultGzipMinSize
+	}
+	if len(opts.ContentTypes) == 0 {
+		opts.ContentTypes = DefaultGzipContentTypes
+	}
+	if _, err := gzip.NewWriterLevel(io.Discard, opts.Level); err != nil {
+		panic("middleware: " + err.Error())
+	}
+
+	pool := &sync.Pool{New: func() any {
+		gz, _ := gzip.NewWriterLevel(io.Discard, opts.Level)
+		return gz
+	}}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipWriter{ResponseWriter: w, opts: &opts, pool: pool}
+			defer func() {
+				// A panicking handler leaves the response to the recovery middleware,
+				// so that the partial body is not written as a successful response.
+				if v := recover(); v != nil {
+					gw.abort()
+					panic(v)
+				}
+				gw.close()
+			}()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header accepts gzip.
+// An explicit gzip entry takes precedence over *, e.g. "*, gzip;q=0" refuses gzip.
+func acceptsGzip(accept string) bool {
+	gzipQ, anyQ := -1.0, -1.0
+	for _, item := range strings.Split(accept, ",") {
+		coding, params, _ := strings.Cut(item, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.ToLower(key) == "q" {
+				if v, err := strconv.ParseFloat(value, 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if coding == "*" {
+			if q > anyQ {
+				anyQ = q
+			}
+		} else if q > gzipQ {
+			gzipQ = q
+		}
+	}
+	if gzipQ >= 0 {
+		return gzipQ > 0
+	}
+	return anyQ > 0
+}
+
+// gzipWriter buffers the response until it reaches the minimum size, is flushed or closed,
+// then decides whether to compress it.
+type gzipWriter struct {
+	http.ResponseWriter
+
+	opts    *GzipOptions
+	pool    *sync.Pool
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+	if w.decided || w.status != 0 {
+		return
+	}
+	if status < http.StatusOK {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.opts.MinSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("middleware: the response writer does not support hijacking")
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *gzipWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header and the buffered body, compressed if allowed and large is true.
+func (w *gzipWriter) decide(large bool) error {
+	w.decided = true
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+	if large && w.compressible(h) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		w.gz = w.pool.Get().(*gzip.Writer)
+		w.gz.Reset(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.gz != nil {
+		_, err := w.gz.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+func (w *gzipWriter) compressible(h http.Header) bool {
+	if h.Get("Content-Encoding") != "" || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range w.opts.ContentTypes {
+		if strings.HasSuffix(allowed, "*") {
+			if mediaType != mimeEventStream && strings.HasPrefix(mediaType, strings.TrimSuffix(allowed, "*")) {
+				return true
+			}
+			continue
+		}
+		if mediaType == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// abort drops the buffered body without writing anything.
+func (w *gzipWriter) abort() {
+	w.buf = nil
+	if w.gz != nil {
+		w.gz.Reset(io.Discard)
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+func (w *gzipWriter) close() {
+	if !w.decided {
+		_ = w.decide(len(w.buf) >= w.opts.MinSize)
+	}
+	if w.gz != nil {
+		_ = w.gz.Close()
+		w.pool.Put(w.gz)
+		w.gz = nil
+	}
+}
+
+// Decompress transparently decompresses the request bodies with the gzip Content-Encoding,
+// reading more than maxSize decompressed bytes, DefaultMaxDecompressedSize if 0, fails with
+// *ctr.BodyTooLargeError. Invalid gzip bodies are replied with 400 bad request,
+// other encodings with 415 unsupported media type.
+func Decompress(maxSize int64) Middleware {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+			default:
+				ctr.ErrorCode(w, http.StatusUnsupportedMediaType, "unsupported content encoding "+r.Header.Get("Content-Encoding"))
+				return
+			}
+
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				ctr.BadRequest(w, "invalid gzip body: "+err.Error())
+				return
+			}
+
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			r.Body = &gzipBody{gz: gz, body: r.Body, n: maxSize, limit: maxSize}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// gzipBody reads the decompressed body up to the limit.
+type gzipBody struct {
+	gz    *gzip.Reader
+	body  io.ReadCloser
+	n     int64
+	limit int64
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		// Probe for the data beyond the limit.
+		var one [1]byte
+		if n, _ := b.gz.Read(one[:]); n > 0 {
+			return 0, &ctr.BodyTooLargeError{Limit: b.limit}
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.gz.Read(p)
+	b.n -= int64(n)
+	return n, err
+}
+
+func (b *gzipBody) Close() error {
+	_ = b.gz.Close()
+	return b.body.Close()
+}
@@ -0,0 +1,304 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+func gzipRequest(accept string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if accept != "" {
+		r.Header.Set("Accept-Encoding", accept)
+	}
+	return r
+}
+
+func gunzip(t *testing.T, data []byte) string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestGzipMinSize(t *testing.T) {
+	large := strings.Repeat("a", DefaultGzipMinSize)
+	tests := []struct {
+		name       string
+		body       string
+		accept     string
+		compressed bool
+	}{
+		{name: "below the threshold", body: large[1:], accept: "gzip", compressed: false},
+		{name: "at the threshold", body: large, accept: "gzip", compressed: true},
+		{name: "in several writes", body: large + large, accept: "br, gzip;q=0.5", compressed: true},
+		{name: "not accepted", body: large, accept: "", compressed: false},
+		{name: "refused", body: large, accept: "gzip;q=0", compressed: false},
+		{name: "wildcard", body: large, accept: "br, *;q=0.1", compressed: true},
+		{name: "refused over wildcard", body: large, accept: "*;q=1, gzip;q=0", compressed: false},
+		{name: "accepted over refused wildcard", body: large, accept: "*;q=0, x-gzip", compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Gzip(GzipOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", ctr.MIMEJSON)
+				w.Header().Set("Content-Length", "1")
+				w.WriteHeader(http.StatusCreated)
+				for i := 0; i < len(tt.body); i += 512 {
+					end := i + 512
+					if end > len(tt.body) {
+						end = len(tt.body)
+					}
+					_, _ = io.WriteString(w, tt.body[i:end])
+				}
+			}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, gzipRequest(tt.accept))
+
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status %d, want %d", rec.Code, http.StatusCreated)
+			}
+			if got := rec.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("Vary %q", got)
+			}
+			if !tt.compressed {
+				if got := rec.Header().Get("Content-Encoding"); got != "" {
+					t.Fatalf("Content-Encoding %q, want none", got)
+				}
+				if rec.Body.String() != tt.body {
+					t.Fatal("the body is changed")
+				}
+				return
+			}
+			if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+				t.Fatalf("Content-Encoding %q, want gzip", got)
+			}
+			if got := rec.Header().Get("Content-Length"); got != "" {
+				t.Fatalf("Content-Length %q is kept", got)
+			}
+			if got := gunzip(t, rec.Body.Bytes()); got != tt.body {
+				t.Fatal("the decompressed body differs")
+			}
+		})
+	}
+}
+
+func TestGzipContentTypes(t *testing.T) {
+	large := strings.Repeat("<p>gzip</p>", 200)
+	tests := []struct {
+		name        string
+		contentType string
+		allowed     []string
+		compressed  bool
+	}{
+		{name: "exact type", contentType: "application/json; charset=utf-8", compressed: true},
+		{name: "wildcard type", contentType: "text/html", compressed: true},
+		{name: "detected type", contentType: "", compressed: true},
+		{name: "unlisted type", contentType: "image/png", compressed: false},
+		{name: "invalid type", contentType: "text/", compressed: false},
+		{name: "custom list", contentType: "text/html", allowed: []string{"application/wasm"}, compressed: false},
+		{name: "custom match", contentType: "application/wasm", allowed: []string{"application/wasm"}, compressed: true},
+		{name: "event stream", contentType: "text/event-stream", compressed: false},
+		{name: "event stream by wildcard", contentType: "text/event-stream", allowed: []string{"text/*"}, compressed: false},
+		{name: "event stream listed", contentType: "text/event-stream", allowed: []string{"text/event-stream"}, compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Gzip(GzipOptions{ContentTypes: tt.allowed})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				_, _ = io.WriteString(w, large)
+			}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, gzipRequest("gzip"))
+
+			compressed := rec.Header().Get("Content-Encoding") == "gzip"
+			if compressed != tt.compressed {
+				t.Fatalf("compressed %v, want %v", compressed, tt.compressed)
+			}
+			body := rec.Body.String()
+			if compressed {
+				body = gunzip(t, rec.Body.Bytes())
+			}
+			if body != large {
+				t.Fatal("the body differs")
+			}
+		})
+	}
+
+	t.Run("encoded response", func(t *testing.T) {
+		h := Gzip(GzipOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Encoding", "br")
+			_, _ = io.WriteString(w, large)
+		}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, gzipRequest("gzip"))
+		if rec.Header().Get("Content-Encoding") != "br" || rec.Body.String() != large {
+			t.Fatal("an encoded response is compressed again")
+		}
+	})
+}
+
+func TestGzipFlush(t *testing.T) {
+	h := Gzip(GzipOptions{ContentTypes: []string{"text/event-stream"}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = io.WriteString(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+
+		rec := w.(interface{ Unwrap() http.ResponseWriter }).Unwrap().(*httptest.ResponseRecorder)
+		if !rec.Flushed {
+			t.Fatal("the flush is not passed on")
+		}
+		gz, err := gzip.NewReader(bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := make([]byte, len("data: first\n\n"))
+		if _, err := io.ReadFull(gz, first); err != nil || string(first) != "data: first\n\n" {
+			t.Fatalf("the flushed data is not readable: %q %v", first, err)
+		}
+
+		_, _ = io.WriteString(w, "data: second\n\n")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, gzipRequest("gzip"))
+
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatal("a flushed response is not compressed")
+	}
+	if got := gunzip(t, rec.Body.Bytes()); got != "data: first\n\ndata: second\n\n" {
+		t.Fatalf("body %q", got)
+	}
+}
+
+func TestGzipPanic(t *testing.T) {
+	h := Chain(Recover(ctr.NewResponder()), Gzip(GzipOptions{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, "partial")
+		panic("boom")
+	}))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, gzipRequest("gzip"))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", rec.Code)
+	}
+	if rec.Header().Get("Content-Encoding") != "" {
+		t.Fatal("the error response is marked as compressed")
+	}
+	if strings.Contains(rec.Body.String(), "partial") {
+		t.Fatal("the partial body is written")
+	}
+}
+
+func TestGzipInvalidLevel(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic")
+		}
+	}()
+	Gzip(GzipOptions{Level: 10})
+}
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompress(t *testing.T) {
+	const limit = 64
+	var (
+		body    []byte
+		readErr error
+	)
+	h := Decompress(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, readErr = io.ReadAll(r.Body)
+		if r.Header.Get("Content-Encoding") != "" {
+			t.Error("Content-Encoding is kept")
+		}
+	}))
+
+	tests := []struct {
+		name     string
+		body     []byte
+		encoding string
+		status   int
+		want     string
+		tooLarge bool
+	}{
+		{name: "identity", body: []byte("plain"), status: http.StatusOK, want: "plain"},
+		{name: "below the cap", body: gzipBytes(t, bytes.Repeat([]byte("a"), limit-1)), encoding: "gzip", status: http.StatusOK, want: strings.Repeat("a", limit-1)},
+		{name: "at the cap", body: gzipBytes(t, bytes.Repeat([]byte("a"), limit)), encoding: "x-gzip", status: http.StatusOK, want: strings.Repeat("a", limit)},
+		{name: "above the cap", body: gzipBytes(t, bytes.Repeat([]byte("a"), 100*limit)), encoding: "gzip", status: http.StatusOK, tooLarge: true},
+		{name: "invalid gzip", body: []byte("plain"), encoding: "gzip", status: http.StatusBadRequest},
+		{name: "unsupported encoding", body: []byte("plain"), encoding: "br", status: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, readErr = nil, nil
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if tt.tooLarge {
+				var tooLarge *ctr.BodyTooLargeError
+				if !errors.As(readErr, &tooLarge) || tooLarge.Limit != limit {
+					t.Fatalf("error %v, want the body too large error", readErr)
+				}
+				if len(body) > limit {
+					t.Fatalf("read %d bytes beyond the cap", len(body))
+				}
+				return
+			}
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if tt.status == http.StatusOK && string(body) != tt.want {
+				t.Fatalf("body %q, want %q", body, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,386 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long the in-memory store keeps the records if unset.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyMaxBody is the maximum size of the fingerprinted bodies if unset.
+	DefaultIdempotencyMaxBody = 1 << 20
+	// DefaultIdempotencyMaxRecord is the maximum size of the recorded response bodies if unset.
+	DefaultIdempotencyMaxRecord = 1 << 20
+)
+
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the state of an idempotency key.
+type IdempotencyRecord struct {
+	// Fingerprint identifies the request which first used the key.
+	Fingerprint string
+	// Done is false while the first request is in flight.
+	Done   bool
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyStore stores the records of the idempotency keys.
+type IdempotencyStore interface {
+	// Begin reserves the key for the request with the fingerprint and returns true,
+	// or returns the existing record of the key and false.
+	Begin(ctx context.Context, key, fingerprint string) (*IdempotencyRecord, bool, error)
+	// Complete records the response of the reserved key.
+	Complete(ctx context.Context, key string, record *IdempotencyRecord) error
+	// Release drops the reservation of the key, so that the request can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions defines the options of the idempotency middleware.
+type IdempotencyOptions struct {
+	// Store stores the records, an in-memory store keeping them for DefaultIdempotencyTTL if nil.
+	Store IdempotencyStore
+	// Methods are the methods honouring the key, POST and PATCH if empty.
+	Methods []string
+	// Scope returns the scope of the keys bound to the client, e.g. the authenticated user,
+	// so that a client cannot replay the responses of another one by reusing its key.
+	// It is required, e.g.
+	//
+	//	Scope: func(r *http.Request) string { return middleware.UserFromContext(r.Context()) }
+	Scope func(r *http.Request) string
+	// MaxBodySize is the maximum size of the fingerprinted bodies, DefaultIdempotencyMaxBody if 0.
+	MaxBodySize int64
+	// MaxRecordSize is the maximum size of the recorded response bodies, DefaultIdempotencyMaxRecord if 0.
+	// Larger responses are not recorded, so that the request can be retried.
+	MaxRecordSize int64
+	// Responder writes the error responses, ctr.DefaultResponder if nil.
+	Responder *ctr.Responder
+}
+
+// Idempotency honours the Idempotency-Key header of unsafe requests.
+// The first response with a key is recorded and replayed with the Idempotent-Replayed header
+// for the retries with the same key and the same method, path, query and body.
+// Reusing the key for a different request is replied with 422 unprocessable entity,
+// and duplicates in flight with 409 conflict. 5xx responses are not recorded,
+// so that the request can be retried. It panics if the scope is nil.
+// Only the headers set by the handler are recorded, the headers set by the outer middlewares,
+// the hop-by-hop headers and the headers of a single request such as Date and RateLimit-* are not replayed.
+func Idempotency(opts IdempotencyOptions) Middleware {
+	if opts.Scope == nil {
+		panic("middleware: idempotency scope must be defined")
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore(DefaultIdempotencyTTL)
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = DefaultIdempotencyMaxBody
+	}
+	if opts.MaxRecordSize <= 0 {
+		opts.MaxRecordSize = DefaultIdempotencyMaxRecord
+	}
+	if opts.Responder == nil {
+		opts.Responder = ctr.DefaultResponder
+	}
+	methods := make(map[string]struct{}, len(opts.Methods))
+	for _, method := range opts.Methods {
+		methods[method] = struct{}{}
+	}
+
+	rs := opts.Responder
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(HeaderIdempotencyKey)
+			if _, ok := methods[r.Method]; !ok || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				rs.BadRequest(w, "idempotency key is too long")
+				return
+			}
+			key = opts.Scope(r) + ":" + key
+
+			fingerprint, err := fingerprintRequest(r, opts.MaxBodySize)
+			if err != nil {
+				rs.Error(w, err)
+				return
+			}
+
+			ctx := r.Context()
+			record, ok, err := opts.Store.Begin(ctx, key, fingerprint)
+			if err != nil {
+				rs.Error(w, err)
+				return
+			}
+			if !ok {
+				switch {
+				case record.Fingerprint != fingerprint:
+					rs.ErrorCode(w, http.StatusUnprocessableEntity, "idempotency key is reused with a different request")
+				case !record.Done:
+					w.Header().Set("Retry-After", "1")
+					rs.ErrorCode(w, http.StatusConflict, "request with the idempotency key is in flight")
+				default:
+					replay(w, record)
+				}
+				return
+			}
+
+			rec := &recordWriter{ResponseWriter: w, limit: opts.MaxRecordSize, before: w.Header().Clone()}
+			completed := false
+			defer func() {
+				if !completed {
+					_ = opts.Store.Release(context.Background(), key)
+				}
+			}()
+			next.ServeHTTP(rec, r)
+
+			status := rec.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if status >= http.StatusInternalServerError || rec.overflow {
+				return
+			}
+			header := rec.header
+			if header == nil {
+				header = handlerHeader(rec.before, w.Header())
+			}
+			if err := opts.Store.Complete(context.Background(), key, &IdempotencyRecord{
+				Fingerprint: fingerprint,
+				Done:        true,
+				Status:      status,
+				Header:      header,
+				Body:        rec.body.Bytes(),
+			}); err != nil {
+				rs.LevelLogger().Error("record idempotent response: "+err.Error(), "key", key)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// fingerprintRequest hashes the method, path, query and body of the request,
+// the body is restored to be read by the handler.
+func fingerprintRequest(r *http.Request, maxSize int64) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+"\n")
+	if r.Body != nil && r.Body != http.NoBody {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSize+1))
+		if err != nil {
+			return "", err
+		}
+		if int64(len(body)) > maxSize {
+			return "", &ctr.BodyTooLargeError{Limit: maxSize}
+		}
+		_ = r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func replay(w http.ResponseWriter, record *IdempotencyRecord) {
+	h := w.Header()
+	for k, v := range record.Header {
+		if replayable(k) {
+			h[k] = append([]string(nil), v...)
+		}
+	}
+	h.Set(HeaderIdempotentReplayed, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
+
+// unreplayedHeaders are the hop-by-hop headers and the headers of a single response.
+var unreplayedHeaders = map[string]bool{
+	"Connection":             true,
+	"Keep-Alive":             true,
+	"Proxy-Connection":       true,
+	"Proxy-Authenticate":     true,
+	"Te":                     true,
+	"Trailer":                true,
+	"Transfer-Encoding":      true,
+	"Upgrade":                true,
+	"Date":                   true,
+	"Retry-After":            true,
+	HeaderIdempotentReplayed: true,
+	http.CanonicalHeaderKey(ctr.HeaderRequestID): true,
+}
+
+func replayable(key string) bool {
+	key = http.CanonicalHeaderKey(key)
+	return !unreplayedHeaders[key] && !strings.HasPrefix(key, "Ratelimit-")
+}
+
+// handlerHeader returns the replayable headers which are added or changed by the handler.
+func handlerHeader(before, after http.Header) http.Header {
+	out := make(http.Header)
+	for k, v := range after {
+		if !replayable(k) || equalValues(before[k], v) {
+			continue
+		}
+		out[k] = append([]string(nil), v...)
+	}
+	return out
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// recordWriter records the response up to the limit while writing it through.
+type recordWriter struct {
+	http.ResponseWriter
+
+	limit int64
+	// before is the header set before the handler.
+	before   http.Header
+	status   int
+	header   http.Header
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *recordWriter) WriteHeader(status int) {
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+		w.header = handlerHeader(w.before, w.Header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.overflow {
+		if int64(w.body.Len()+len(b)) > w.limit {
+			w.overflow = true
+			w.body = bytes.Buffer{}
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (w *recordWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// MemoryIdempotencyStore is an in-memory IdempotencyStore, the records expire after the ttl.
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	records   map[string]*memoryRecord
+	lastSweep time.Time
+}
+
+type memoryRecord struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	return &MemoryIdempotencyStore{ttl: ttl, records: make(map[string]*memoryRecord)}
+}
+
+func (s *MemoryIdempotencyStore) Begin(_ context.Context, key, fingerprint string) (*IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	if mr, ok := s.records[key]; ok && now.Before(mr.expires) {
+		record := mr.record
+		return &record, false, nil
+	}
+	s.records[key] = &memoryRecord{
+		record:  IdempotencyRecord{Fingerprint: fingerprint},
+		expires: now.Add(s.ttl),
+	}
+	return nil, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(_ context.Context, key string, record *IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[key]; !ok {
+		return errors.New("idempotency key is not reserved")
+	}
+	s.records[key] = &memoryRecord{record: *record, expires: time.Now().Add(s.ttl)}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// sweep drops the expired records at most once a minute.
+func (s *MemoryIdempotencyStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, mr := range s.records {
+		if !now.Before(mr.expires) {
+			delete(s.records, key)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+func TestIdempotencyReplayHeader(t *testing.T) {
+	var calls int
+	store := NewMemoryIdempotencyStore(0)
+	h := Chain(
+		RequestID(nil),
+		RateLimit(RateLimitOptions{Limit: 10, Key: KeyByHeader("X-API-Key")}),
+		CORS(CORSOptions{AllowedOrigins: []string{"https://a.example.com"}}),
+		Idempotency(IdempotencyOptions{
+			Store: store,
+			Scope: func(r *http.Request) string { return r.Header.Get("X-API-Key") },
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Location", "/users/"+strconv.Itoa(calls))
+		w.Header().Add("Vary", "Accept")
+		w.Header().Set("Date", "Mon, 01 Jan 2024 00:00:00 GMT")
+		w.Header().Set("Content-Type", ctr.MIMEJSON)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, `{"id": 1}`)
+	}))
+	do := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name": "alice"}`))
+		r.Header.Set(HeaderIdempotencyKey, "key")
+		r.Header.Set("X-API-Key", "client")
+		r.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	first := do("https://a.example.com")
+	if first.Code != http.StatusCreated || first.Header().Get("Access-Control-Allow-Origin") != "https://a.example.com" {
+		t.Fatalf("status %d, header %v", first.Code, first.Header())
+	}
+	record, _, err := store.Begin(context.Background(), "client:key", "")
+	if err != nil || record == nil {
+		t.Fatalf("the response is not recorded: %v", err)
+	}
+	for _, k := range []string{ctr.HeaderRequestID, "RateLimit-Remaining", "Access-Control-Allow-Origin", "Date"} {
+		if _, ok := record.Header[http.CanonicalHeaderKey(k)]; ok {
+			t.Errorf("%s is recorded", k)
+		}
+	}
+
+	second := do("https://b.example.com")
+	if calls != 1 {
+		t.Fatal("the request is not replayed")
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Fatalf("status %d, body %q", second.Code, second.Body.String())
+	}
+	h2 := second.Header()
+	if h2.Get(HeaderIdempotentReplayed) != "true" || h2.Get("Location") != "/users/1" || h2.Get("Content-Type") != ctr.MIMEJSON {
+		t.Fatalf("the handler headers are not replayed: %v", h2)
+	}
+	if h2.Get(ctr.HeaderRequestID) == "" || h2.Get(ctr.HeaderRequestID) == first.Header().Get(ctr.HeaderRequestID) {
+		t.Fatal("the request ID of the first response is replayed")
+	}
+	if h2.Get("RateLimit-Remaining") != "8" {
+		t.Fatalf("RateLimit-Remaining %q, want the one of the replay", h2.Get("RateLimit-Remaining"))
+	}
+	if h2.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("the CORS headers of the first origin are replayed")
+	}
+	if h2.Get("Date") != "" {
+		t.Fatal("the date of the first response is replayed")
+	}
+	if vary := strings.Join(h2.Values("Vary"), ", "); !strings.Contains(vary, "Origin") || !strings.Contains(vary, "Accept") {
+		t.Fatalf("Vary %q", vary)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// JWTClaims are the registered claims of a JWT checked by the JWT verifier,
+// custom claims types embed it, e.g.
+//
+//	type Claims struct {
+//		middleware.JWTClaims
+//		Role string `json:"role"`
+//	}
+type JWTClaims struct {
+	Issuer    string      `json:"iss,omitempty"`
+	Subject   string      `json:"sub,omitempty"`
+	Audience  Audience    `json:"aud,omitempty"`
+	ExpiresAt NumericDate `json:"exp,omitempty"`
+	NotBefore NumericDate `json:"nbf,omitempty"`
+	IssuedAt  NumericDate `json:"iat,omitempty"`
+	ID        string      `json:"jti,omitempty"`
+}
+
+// Audience is the aud claim, which is a single string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return errors.New("aud must be a string or an array of strings")
+	}
+	*a = multi
+	return nil
+}
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a Audience) contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericDate is a time in unix seconds, 0 means absent.
+type NumericDate int64
+
+func (d *NumericDate) UnmarshalJSON(data []byte) error {
+	var f float64
+	if err := json.Unmarshal(data, &f); err != nil {
+		return errors.New("date must be a number")
+	}
+	*d = NumericDate(math.Floor(f))
+	return nil
+}
+
+// Time returns the time of the date.
+func (d NumericDate) Time() time.Time {
+	return time.Unix(int64(d), 0)
+}
+
+// MinJWTHMACKeySize is the minimum size of the HS256 key in bytes.
+const MinJWTHMACKeySize = 32
+
+// JWTOptions defines the keys and the claims checked by the JWT verifier.
+type JWTOptions struct {
+	// HMACKey verifies HS256 tokens if set, it must have at least MinJWTHMACKeySize bytes.
+	HMACKey []byte
+	// ECDSAKey verifies ES256 tokens if set, it must be on the P-256 curve.
+	ECDSAKey *ecdsa.PublicKey
+	// Audience must be contained in the aud claim if set.
+	Audience string
+	// Issuer must be the iss claim if set.
+	Issuer string
+	// Leeway allows for the clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// AllowMissingExp accepts the tokens without the exp claim, which never expire.
+	// The exp claim is required by default.
+	AllowMissingExp bool
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+}
+
+// NewJWTVerifier returns the TokenVerifier of compact HS256 and ES256 JWTs, which checks the signature
+// by the key of the algorithm, then exp, nbf, aud and iss, and returns the claims decoded as T.
+// Tokens without exp are rejected unless AllowMissingExp is set.
+// Algorithms without a configured key, including none, are rejected.
+// It panics if the HMAC key is set but shorter than MinJWTHMACKeySize.
+func NewJWTVerifier[T any](opts JWTOptions) TokenVerifier {
+	if opts.HMACKey != nil && len(opts.HMACKey) < MinJWTHMACKeySize {
+		panic(fmt.Sprintf("middleware: JWT HMAC key must be at least %d bytes", MinJWTHMACKeySize))
+	}
+	opts.HMACKey = append([]byte(nil), opts.HMACKey...)
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return TokenVerifierFunc(func(_ context.Context, token string) (any, error) {
+		payload, err := verifyJWT(token, &opts)
+		if err != nil {
+			return nil, err
+		}
+		var claims T
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			return nil, fmt.Errorf("%w: invalid claims", ErrInvalidToken)
+		}
+		return claims, nil
+	})
+}
+
+func verifyJWT(token string, opts *JWTOptions) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Alg == "HS256" && len(opts.HMACKey) > 0:
+		mac := hmac.New(sha256.New, opts.HMACKey)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	case header.Alg == "ES256" && opts.ECDSAKey != nil:
+		if opts.ECDSAKey.Curve != elliptic.P256() || len(sig) != 64 {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+		digest := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(opts.ECDSAKey, digest[:], r, s) {
+			return nil, fmt.Errorf("%w: invalid signature", ErrInvalidToken)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed payload", ErrInvalidToken)
+	}
+	var claims JWTClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidToken)
+	}
+
+	now := opts.Now()
+	if claims.ExpiresAt == 0 && !opts.AllowMissingExp {
+		return nil, fmt.Errorf("%w: token has no expiration", ErrInvalidToken)
+	}
+	if claims.ExpiresAt != 0 && !now.Before(claims.ExpiresAt.Time().Add(opts.Leeway)) {
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(opts.Leeway).Before(claims.NotBefore.Time()) {
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	}
+	if opts.Audience != "" && !claims.Audience.contains(opts.Audience) {
+		return nil, fmt.Errorf("%w: token is not for this audience", ErrInvalidToken)
+	}
+	if opts.Issuer != "" && claims.Issuer != opts.Issuer {
+		return nil, fmt.Errorf("%w: token is not from this issuer", ErrInvalidToken)
+	}
+	return payload, nil
+}
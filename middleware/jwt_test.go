@@ -0,0 +1,331 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+var testHMACKey = []byte("0123456789abcdef0123456789abcdef")
+
+type testClaims struct {
+	JWTClaims
+	Role string `json:"role"`
+}
+
+func encodeSegment(t *testing.T, v any) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signHS256(t *testing.T, key []byte, header, claims any) string {
+	t.Helper()
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, claims any) string {
+	t.Helper()
+	signed := encodeSegment(t, map[string]string{"alg": "ES256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func hs256Header() map[string]string {
+	return map[string]string{"alg": "HS256", "typ": "JWT"}
+}
+
+func TestJWTClaims(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	verifier := NewJWTVerifier[testClaims](JWTOptions{
+		HMACKey:  testHMACKey,
+		Audience: "api",
+		Issuer:   "auth",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return now },
+	})
+	valid := testClaims{
+		JWTClaims: JWTClaims{
+			Issuer:    "auth",
+			Subject:   "alice",
+			Audience:  Audience{"web", "api"},
+			ExpiresAt: NumericDate(now.Add(time.Minute).Unix()),
+			NotBefore: NumericDate(now.Add(-time.Minute).Unix()),
+		},
+		Role: "admin",
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *testClaims)
+		err    string
+	}{
+		{name: "valid", modify: func(c *testClaims) {}},
+		{name: "single audience", modify: func(c *testClaims) { c.Audience = Audience{"api"} }},
+		{name: "expired", modify: func(c *testClaims) { c.ExpiresAt = NumericDate(now.Add(-time.Minute).Unix()) }, err: "expired"},
+		{name: "expired within leeway", modify: func(c *testClaims) { c.ExpiresAt = NumericDate(now.Add(-10 * time.Second).Unix()) }},
+		{name: "expires now with leeway", modify: func(c *testClaims) { c.ExpiresAt = NumericDate(now.Add(-30 * time.Second).Unix()) }, err: "expired"},
+		{name: "not valid yet", modify: func(c *testClaims) { c.NotBefore = NumericDate(now.Add(time.Minute).Unix()) }, err: "not valid yet"},
+		{name: "not before within leeway", modify: func(c *testClaims) { c.NotBefore = NumericDate(now.Add(10 * time.Second).Unix()) }},
+		{name: "wrong audience", modify: func(c *testClaims) { c.Audience = Audience{"web"} }, err: "audience"},
+		{name: "missing audience", modify: func(c *testClaims) { c.Audience = nil }, err: "audience"},
+		{name: "wrong issuer", modify: func(c *testClaims) { c.Issuer = "other" }, err: "issuer"},
+		{name: "missing issuer", modify: func(c *testClaims) { c.Issuer = "" }, err: "issuer"},
+		{name: "missing expiration", modify: func(c *testClaims) { c.ExpiresAt = 0 }, err: "no expiration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid
+			tt.modify(&claims)
+			got, err := verifier.Verify(context.Background(), signHS256(t, testHMACKey, hs256Header(), claims))
+			if tt.err != "" {
+				if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, ok := got.(testClaims)
+			if !ok || c.Subject != "alice" || c.Role != "admin" {
+				t.Fatalf("claims %#v", got)
+			}
+		})
+	}
+
+	t.Run("missing expiration allowed", func(t *testing.T) {
+		verifier := NewJWTVerifier[testClaims](JWTOptions{HMACKey: testHMACKey, AllowMissingExp: true})
+		claims := testClaims{JWTClaims: JWTClaims{Subject: "alice"}}
+		if _, err := verifier.Verify(context.Background(), signHS256(t, testHMACKey, hs256Header(), claims)); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestJWTAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := JWTClaims{Subject: "alice", ExpiresAt: NumericDate(time.Now().Add(time.Hour).Unix())}
+
+	hsOnly := NewJWTVerifier[JWTClaims](JWTOptions{HMACKey: testHMACKey})
+	esOnly := NewJWTVerifier[JWTClaims](JWTOptions{ECDSAKey: &ecKey.PublicKey})
+	both := NewJWTVerifier[JWTClaims](JWTOptions{HMACKey: testHMACKey, ECDSAKey: &ecKey.PublicKey})
+
+	esToken := signES256(t, ecKey, claims)
+	parts := strings.Split(esToken, ".")
+	rawSig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+
+	tests := []struct {
+		name     string
+		verifier TokenVerifier
+		token    string
+		valid    bool
+	}{
+		{name: "HS256", verifier: hsOnly, token: signHS256(t, testHMACKey, hs256Header(), claims), valid: true},
+		{name: "HS256 with both keys", verifier: both, token: signHS256(t, testHMACKey, hs256Header(), claims), valid: true},
+		{name: "HS256 with another key", verifier: hsOnly, token: signHS256(t, []byte(strings.Repeat("x", 32)), hs256Header(), claims)},
+		{name: "ES256 raw signature", verifier: esOnly, token: esToken, valid: true},
+		{name: "ES256 with both keys", verifier: both, token: esToken, valid: true},
+		{name: "ES256 with another key", verifier: esOnly, token: signES256(t, otherKey, claims)},
+		{
+			name:     "ES256 DER signature",
+			verifier: esOnly,
+			token: func() string {
+				digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+				der, err := ecdsa.SignASN1(rand.Reader, ecKey, digest[:])
+				if err != nil {
+					t.Fatal(err)
+				}
+				return parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(der)
+			}(),
+		},
+		{
+			name:     "ES256 truncated signature",
+			verifier: esOnly,
+			token:    parts[0] + "." + parts[1] + "." + base64.RawURLEncoding.EncodeToString(rawSig[:63]),
+		},
+		{name: "ES256 without its key", verifier: hsOnly, token: esToken},
+		{
+			name:     "HS256 signed with the public key",
+			verifier: esOnly,
+			token:    signHS256(t, publicDER, hs256Header(), claims),
+		},
+		{
+			name:     "none",
+			verifier: both,
+			token:    encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims) + ".",
+		},
+		{
+			name:     "none with a signature",
+			verifier: both,
+			token:    signHS256(t, testHMACKey, map[string]string{"alg": "none"}, claims),
+		},
+		{
+			name:     "HS512",
+			verifier: hsOnly,
+			token:    signHS256(t, testHMACKey, map[string]string{"alg": "HS512"}, claims),
+		},
+		{name: "malformed", verifier: both, token: "a.b"},
+		{name: "malformed header", verifier: both, token: "!." + parts[1] + "." + parts[2]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.verifier.Verify(context.Background(), tt.token)
+			if tt.valid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("error %v, want an invalid token error", err)
+			}
+		})
+	}
+}
+
+func TestJWTHMACKeySize(t *testing.T) {
+	for _, key := range [][]byte{{}, testHMACKey[:MinJWTHMACKeySize-1]} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic for a key of %d bytes", len(key))
+				}
+			}()
+			NewJWTVerifier[JWTClaims](JWTOptions{HMACKey: key})
+		}()
+	}
+
+	// Without a HMAC key, the tokens signed by an empty key are rejected.
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := NewJWTVerifier[JWTClaims](JWTOptions{ECDSAKey: &ecKey.PublicKey})
+	token := signHS256(t, nil, hs256Header(), JWTClaims{Subject: "alice"})
+	if _, err := verifier.Verify(context.Background(), token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("error %v, want an invalid token error", err)
+	}
+	if _, err := verifyJWT(token, &JWTOptions{HMACKey: []byte{}, Now: time.Now}); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("error %v, want an invalid token error", err)
+	}
+}
+
+func TestBearerAuthChallenge(t *testing.T) {
+	verifier := NewJWTVerifier[testClaims](JWTOptions{HMACKey: testHMACKey})
+	failing := TokenVerifierFunc(func(ctx context.Context, token string) (any, error) {
+		return nil, errors.New("database is down")
+	})
+	exp := NumericDate(time.Now().Add(time.Hour).Unix())
+	valid := signHS256(t, testHMACKey, hs256Header(), testClaims{JWTClaims: JWTClaims{Subject: "alice", ExpiresAt: exp}, Role: "admin"})
+	expired := signHS256(t, testHMACKey, hs256Header(), JWTClaims{ExpiresAt: 1})
+
+	tests := []struct {
+		name          string
+		verifier      TokenVerifier
+		realm         string
+		authorization string
+		status        int
+		challenge     string
+	}{
+		{name: "valid", verifier: verifier, authorization: "Bearer " + valid, status: http.StatusOK},
+		{name: "lower case scheme", verifier: verifier, authorization: "bearer " + valid, status: http.StatusOK},
+		{name: "missing", verifier: verifier, status: http.StatusUnauthorized, challenge: "Bearer"},
+		{name: "missing with realm", verifier: verifier, realm: "api", status: http.StatusUnauthorized, challenge: `Bearer realm="api"`},
+		{name: "basic scheme", verifier: verifier, authorization: "Basic YTpi", status: http.StatusUnauthorized, challenge: "Bearer"},
+		{name: "escaped realm", verifier: verifier, realm: `api "v1" \ é`, status: http.StatusUnauthorized, challenge: `Bearer realm="api \"v1\" \\ é"`},
+		{
+			name:          "expired",
+			verifier:      verifier,
+			realm:         "api",
+			authorization: "Bearer " + expired,
+			status:        http.StatusUnauthorized,
+			challenge:     `Bearer realm="api", error="invalid_token", error_description="invalid token: token is expired"`,
+		},
+		{
+			name:          "verifier failure",
+			verifier:      failing,
+			authorization: "Bearer " + valid,
+			status:        http.StatusUnauthorized,
+			challenge:     `Bearer error="invalid_token", error_description="invalid token"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := BearerAuth(tt.verifier, AuthOptions{Realm: tt.realm, Responder: ctr.NewResponder()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				claims, ok := ClaimsFromContext[testClaims](r.Context())
+				if !ok || claims.Role != "admin" {
+					t.Errorf("claims %#v", claims)
+				}
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d", rec.Code, tt.status)
+			}
+			if got := rec.Header().Get("WWW-Authenticate"); got != tt.challenge {
+				t.Fatalf("WWW-Authenticate %q, want %q", got, tt.challenge)
+			}
+			if strings.Contains(rec.Body.String(), "database") {
+				t.Fatal("the verifier error is exposed")
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import "net/http"
+
+// Middleware wraps an http.Handler with additional behaviour.
+type Middleware func(next http.Handler) http.Handler
+
+// Chain composes the middlewares into one, the first one is the outermost, e.g.
+//
+//	handler := middleware.Chain(
+//		middleware.RequestID(nil),
+//		middleware.AccessLog(nil),
+//		middleware.Recover(nil),
+//	)(mux)
+func Chain(mws ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			next = mws[i](next)
+		}
+		return next
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"container/list"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+// DefaultRateLimitMaxKeys is the maximum number of keys tracked by the rate limit if unset.
+const DefaultRateLimitMaxKeys = 1 << 16
+
+// RateLimitOptions defines the options of the rate limit middleware.
+type RateLimitOptions struct {
+	// Limit is the number of requests allowed per Period by a key, which can be spent in a burst.
+	Limit int
+	// Period is the time in which the Limit is replenished, a minute if 0.
+	Period time.Duration
+	// Key extracts the key of the request, KeyByIP if nil. Requests with an empty key are not limited.
+	Key func(r *http.Request) string
+	// MaxKeys is the maximum number of keys tracked at once, DefaultRateLimitMaxKeys if 0.
+	// When it is reached, the bucket of the least recently seen key is evicted,
+	// so that key starts over with a full bucket.
+	MaxKeys int
+	// Responder writes the 429 responses, ctr.DefaultResponder if nil.
+	Responder *ctr.Responder
+}
+
+// KeyByIP returns the client IP of the request from its remote address.
+// Proxy headers are not trusted, the remote address should be rewritten by a trusted proxy middleware.
+func KeyByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// KeyByHeader returns the key extractor of the request header, e.g. X-API-Key.
+func KeyByHeader(name string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// RateLimit limits the requests of every key by a token bucket in memory.
+// The RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers are set on every response,
+// and the requests over the limit are replied by TooManyRequests with the Retry-After header.
+// The buckets of the keys idle for a whole period, which are full again, are expired,
+// and the least recently seen ones are evicted beyond MaxKeys.
+func RateLimit(opts RateLimitOptions) Middleware {
+	if opts.Limit <= 0 {
+		panic("middleware: rate limit must be positive")
+	}
+	if opts.Period <= 0 {
+		opts.Period = time.Minute
+	}
+	if opts.Key == nil {
+		opts.Key = KeyByIP
+	}
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultRateLimitMaxKeys
+	}
+	if opts.Responder == nil {
+		opts.Responder = ctr.DefaultResponder
+	}
+
+	l := newBucketLimiter(opts.Limit, opts.Period, opts.MaxKeys)
+	policy := strconv.Itoa(opts.Limit) + ";w=" + strconv.Itoa(int(math.Ceil(opts.Period.Seconds())))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := opts.Key(r)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res := l.allow(key, time.Now())
+			h := w.Header()
+			h.Set("RateLimit-Policy", policy)
+			h.Set("RateLimit-Limit", strconv.Itoa(opts.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.reset)))
+			if !res.ok {
+				h.Set("Retry-After", strconv.Itoa(seconds(res.retryAfter)))
+				opts.Responder.TooManyRequests(w, "rate limit exceeded, retry in "+strconv.Itoa(seconds(res.retryAfter))+"s")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// seconds rounds the duration up to whole seconds.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+type bucketResult struct {
+	ok         bool
+	remaining  int
+	reset      time.Duration
+	retryAfter time.Duration
+}
+
+// bucketLimiter keeps a token bucket per key,
+// ordered from the most to the least recently seen key.
+type bucketLimiter struct {
+	mu       sync.Mutex
+	limit    float64
+	period   time.Duration
+	perToken time.Duration
+	maxKeys  int
+	buckets  map[string]*list.Element
+	order    *list.List
+}
+
+func newBucketLimiter(limit int, period time.Duration, maxKeys int) *bucketLimiter {
+	perToken := period / time.Duration(limit)
+	if perToken <= 0 {
+		perToken = 1
+	}
+	return &bucketLimiter{
+		limit:    float64(limit),
+		period:   period,
+		perToken: perToken,
+		maxKeys:  maxKeys,
+		buckets:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (l *bucketLimiter) allow(key string, now time.Time) bucketResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+
+	var b *bucket
+	if e, ok := l.buckets[key]; ok {
+		b = e.Value.(*bucket)
+		l.order.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= l.maxKeys {
+			l.remove(l.order.Back())
+		}
+		b = &bucket{key: key, tokens: l.limit, last: now}
+		l.buckets[key] = l.order.PushFront(b)
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.limit, b.tokens+float64(elapsed)/float64(l.perToken))
+		b.last = now
+	}
+
+	var res bucketResult
+	if b.tokens >= 1 {
+		b.tokens--
+		res.ok = true
+	} else {
+		res.retryAfter = time.Duration((1 - b.tokens) * float64(l.perToken))
+	}
+	res.remaining = int(b.tokens)
+	res.reset = time.Duration((l.limit - b.tokens) * float64(l.perToken))
+	return res
+}
+
+// sweep expires the buckets idle for a period, starting from the least recently seen one.
+func (l *bucketLimiter) sweep(now time.Time) {
+	for e := l.order.Back(); e != nil; e = l.order.Back() {
+		if now.Sub(e.Value.(*bucket).last) < l.period {
+			return
+		}
+		l.remove(e)
+	}
+}
+
+func (l *bucketLimiter) remove(e *list.Element) {
+	b := l.order.Remove(e).(*bucket)
+	delete(l.buckets, b.key)
+}
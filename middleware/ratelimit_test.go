@@ -0,0 +1,103 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := RateLimit(RateLimitOptions{Limit: 2, Key: KeyByHeader("X-API-Key")})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	do := func(key string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for i := 1; i >= 0; i-- {
+		rec := do("a")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status %d, want 200", rec.Code)
+		}
+		if got := rec.Header().Get("RateLimit-Remaining"); got != strconv.Itoa(i) {
+			t.Fatalf("remaining %s, want %d", got, i)
+		}
+	}
+	rec := do("a")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "30" {
+		t.Fatalf("Retry-After %q, want 30", rec.Header().Get("Retry-After"))
+	}
+	if rec := do(""); rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+		t.Fatal("a request without key is limited")
+	}
+}
+
+func TestRateLimitMaxKeys(t *testing.T) {
+	l := newBucketLimiter(1, time.Minute, 2)
+	now := time.Now()
+	for _, key := range []string{"a", "b"} {
+		if !l.allow(key, now).ok {
+			t.Fatalf("the first request of %s is refused", key)
+		}
+	}
+	// a is seen again, so b is the least recently seen key.
+	if l.allow("a", now).ok {
+		t.Fatal("the bucket of a is not spent")
+	}
+
+	if !l.allow("c", now).ok {
+		t.Fatal("the first request of c is refused")
+	}
+	if len(l.buckets) != 2 || l.order.Len() != 2 {
+		t.Fatalf("%d keys are tracked, want 2", len(l.buckets))
+	}
+	if _, ok := l.buckets["b"]; ok {
+		t.Fatal("the least recently seen key is not evicted")
+	}
+	if l.allow("a", now).ok {
+		t.Fatal("the recently seen key is evicted")
+	}
+	// b starts over with a full bucket, which evicts c.
+	if !l.allow("b", now).ok {
+		t.Fatal("the evicted key is still limited")
+	}
+	if _, ok := l.buckets["c"]; ok {
+		t.Fatal("c is not evicted")
+	}
+}
+
+func TestRateLimitExpiry(t *testing.T) {
+	l := newBucketLimiter(1, time.Minute, DefaultRateLimitMaxKeys)
+	now := time.Now()
+	l.allow("a", now)
+	l.allow("b", now.Add(30*time.Second))
+
+	l.allow("c", now.Add(time.Minute))
+	if _, ok := l.buckets["a"]; ok {
+		t.Fatal("the idle key is not expired")
+	}
+	if _, ok := l.buckets["b"]; !ok {
+		t.Fatal("the active key is expired")
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+// PanicError is the error of a recovered panic.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n%s", e.Value, e.Stack)
+}
+
+// Recover recovers the panics of the handler and writes them as 500 internal server errors
+// by the Error of the responder, ctr.DefaultResponder if nil, which logs the panic with its stack.
+// The response is left as it is if it has already been started.
+// http.ErrAbortHandler is re-panicked to abort the response as intended.
+func Recover(rs *ctr.Responder) Middleware {
+	if rs == nil {
+		rs = ctr.DefaultResponder
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := ctr.NewResponseWriter(w, r)
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				err := &PanicError{Value: v, Stack: debug.Stack()}
+				if rw.Status() != 0 {
+					rs.LevelLogger().Error(err.Error(), "method", r.Method, "path", r.URL.Path)
+					return
+				}
+				rs.Error(rw, err)
+			}()
+			next.ServeHTTP(rw.Writer(), r)
+		})
+	}
+}
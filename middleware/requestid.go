@@ -0,0 +1,66 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/99nil/gopkg/ctr"
+)
+
+// maxRequestIDLength bounds the propagated request IDs.
+const maxRequestIDLength = 128
+
+// RequestID propagates the X-Request-ID header of the request, or generates one by the generator,
+// a random hex string if nil. The ID is set to the request context, see ctr.RequestIDFromContext,
+// to the request header for the handlers and proxies downstream, and to the response header.
+func RequestID(generator func() string) Middleware {
+	if generator == nil {
+		generator = newRequestID
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(ctr.HeaderRequestID)
+			if !validRequestID(id) {
+				id = generator()
+			}
+
+			r.Header.Set(ctr.HeaderRequestID, id)
+			w.Header().Set(ctr.HeaderRequestID, id)
+			next.ServeHTTP(w, r.WithContext(ctr.ContextWithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether the client supplied ID is safe to propagate and log.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,197 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrDuplicateEvent = errors.New("event already registered")
+	ErrUnknownEvent   = errors.New("event not registered")
+)
+
+// DecodeError is returned when the data of an event cannot be decoded.
+type DecodeError struct {
+	Event string
+	Data  string
+	Err   error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode event %s failed: %v", e.Event, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// Event declares a typed event once for both the Sender and the Receiver.
+//
+//	var Progress = sse.Event[ProgressData]{Name: "progress"}
+type Event[T any] struct {
+	Name string
+	// Marshal encodes the value into the message data, json by default.
+	Marshal func(v T) (string, error)
+	// Unmarshal decodes the message data into the value, json by default.
+	Unmarshal func(data []byte) (T, error)
+}
+
+// Message encodes the value into a message of the event.
+func (e Event[T]) Message(v T) (*Message, error) {
+	var (
+		data string
+		err  error
+	)
+	if e.Marshal != nil {
+		data, err = e.Marshal(v)
+	} else {
+		var b []byte
+		b, err = json.Marshal(v)
+		data = string(b)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Message{Event: e.Name, Data: data}, nil
+}
+
+// Cover encodes the value into messages of the event, it can be used as the coverFn of SendLoop.
+func (e Event[T]) Cover(v T) ([]*Message, error) {
+	m, err := e.Message(v)
+	if err != nil {
+		return nil, err
+	}
+	return []*Message{m}, nil
+}
+
+// Send encodes the value and sends it to the Sender.
+func (e Event[T]) Send(s *Sender, v T) error {
+	m, err := e.Message(v)
+	if err != nil {
+		return err
+	}
+	s.Send(m)
+	return nil
+}
+
+// Decode decodes the message of the event into the value.
+func (e Event[T]) Decode(m *Message) (T, error) {
+	var (
+		out T
+		err error
+	)
+	if eventName(m.Event) != eventName(e.Name) {
+		return out, &DecodeError{
+			Event: m.Event,
+			Data:  m.Data,
+			Err:   fmt.Errorf("unexpected event, expected %s", e.Name),
+		}
+	}
+	if e.Unmarshal != nil {
+		out, err = e.Unmarshal([]byte(m.Data))
+	} else {
+		err = json.Unmarshal([]byte(m.Data), &out)
+	}
+	if err != nil {
+		return out, &DecodeError{Event: m.Event, Data: m.Data, Err: err}
+	}
+	return out, nil
+}
+
+// NewReceiver returns a Receiver of the event,
+// the data which cannot be decoded is reported as *DecodeError by Receiver.Err.
+func (e Event[T]) NewReceiver(reader io.Reader, opts ...any) *Receiver[T] {
+	r := newReceiver[T](reader, func(event string) bool {
+		return eventName(event) == eventName(e.Name)
+	}, e.Decode)
+	r.setOptions(opts...)
+	return r
+}
+
+func (e Event[T]) validate() error {
+	if e.Name == "" {
+		return errors.New("event name must be defined")
+	}
+	if e.Name == EventError {
+		return fmt.Errorf("event name %s is reserved", EventError)
+	}
+	if strings.ContainsAny(e.Name, "\r\n") {
+		return fmt.Errorf("event name %q contains line breaks", e.Name)
+	}
+	return nil
+}
+
+// eventName returns the effective name of an event,
+// a message without event name is dispatched as a message event.
+func eventName(name string) string {
+	if name == "" {
+		return EventMessage
+	}
+	return name
+}
+
+// Registry holds the typed events which can be received on the same stream.
+// Pass it as an option to NewReceiver to receive every registered event as its declared type.
+type Registry struct {
+	mu     sync.RWMutex
+	events map[string]func(m *Message) (any, error)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{events: make(map[string]func(m *Message) (any, error))}
+}
+
+// Register adds the event to the registry,
+// it fails with ErrDuplicateEvent if the event name is already registered.
+func Register[T any](r *Registry, e Event[T]) error {
+	if err := e.validate(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.events[e.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateEvent, e.Name)
+	}
+	r.events[e.Name] = func(m *Message) (any, error) {
+		return e.Decode(m)
+	}
+	return nil
+}
+
+// Has reports whether the event is registered.
+func (r *Registry) Has(event string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.events[eventName(event)]
+	return ok
+}
+
+// Decode decodes the message into the type of the registered event.
+func (r *Registry) Decode(m *Message) (any, error) {
+	r.mu.RLock()
+	decode, ok := r.events[eventName(m.Event)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, m.Event)
+	}
+	return decode(m)
+}
@@ -0,0 +1,273 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sse
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RatePolicy decides what happens to the events exceeding the rate limit of a Sender.
+type RatePolicy int
+
+const (
+	// RateDelay waits until the event can be sent.
+	RateDelay RatePolicy = iota
+	// RateDrop discards the event.
+	RateDrop
+	// RateCoalesce keeps only the latest event of each event name,
+	// which is sent as soon as the limit allows.
+	RateCoalesce
+)
+
+// RateLimiter is a token bucket which can be shared by several senders,
+// e.g. all streams of the same client.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter returns a limiter which allows rate events per second
+// with bursts of at most burst events. A rate <= 0 means no limit.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	l := new(RateLimiter)
+	l.SetLimit(rate, burst)
+	l.tokens = l.burst
+	return l
+}
+
+// SetLimit changes the limit, e.g. when the subscription tier of a client changes.
+func (l *RateLimiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.advance(time.Now())
+	l.rate = rate
+	l.burst = float64(burst)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Allow reports whether an event can be sent now and takes a token if so.
+func (l *RateLimiter) Allow() bool {
+	return l.reserve() == 0
+}
+
+// Wait blocks until an event can be sent or the context is done.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	return l.wait(ctx, nil)
+}
+
+func (l *RateLimiter) wait(ctx context.Context, closeCh <-chan struct{}) error {
+	for {
+		d := l.reserve()
+		if d == 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-closeCh:
+			timer.Stop()
+			return context.Canceled
+		case <-timer.C:
+		}
+	}
+}
+
+// reserve takes a token and returns 0 if one is available,
+// otherwise it returns the duration until the next token.
+func (l *RateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.advance(time.Now())
+	if l.tokens >= 1 {
+		l.tokens--
+		return 0
+	}
+	d := time.Duration(math.Ceil((1 - l.tokens) / l.rate * float64(time.Second)))
+	if d <= 0 {
+		d = time.Nanosecond
+	}
+	return d
+}
+
+func (l *RateLimiter) advance(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// RateLimiterSet shares a RateLimiter between the streams of the same client.
+type RateLimiterSet struct {
+	mu       sync.Mutex
+	limitFn  func(key string) (rate float64, burst int)
+	limiters map[string]*sharedRateLimiter
+}
+
+type sharedRateLimiter struct {
+	limiter *RateLimiter
+	refs    int
+}
+
+// NewRateLimiterSet returns a set which creates the limiter of a client by limitFn,
+// e.g. according to the subscription tier of the client.
+// It panics if limitFn is nil.
+func NewRateLimiterSet(limitFn func(key string) (rate float64, burst int)) *RateLimiterSet {
+	if limitFn == nil {
+		panic("sse: rate limit function must be defined")
+	}
+	return &RateLimiterSet{
+		limitFn:  limitFn,
+		limiters: make(map[string]*sharedRateLimiter),
+	}
+}
+
+// Get returns the limiter of the client, release must be called when the stream ends,
+// the limiter is removed after the last stream of the client is released.
+func (s *RateLimiterSet) Get(key string) (limiter *RateLimiter, release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	shared, ok := s.limiters[key]
+	if !ok {
+		shared = &sharedRateLimiter{limiter: NewRateLimiter(s.limitFn(key))}
+		s.limiters[key] = shared
+	}
+	shared.refs++
+
+	var once sync.Once
+	return shared.limiter, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			shared.refs--
+			if shared.refs <= 0 && s.limiters[key] == shared {
+				delete(s.limiters, key)
+			}
+		})
+	}
+}
+
+// RateLimitFunc is an option of Handler and WebSocketHandler which returns the limiter of
+// the requesting client, release is called when the stream ends. It fits RateLimiterSet.Get:
+//
+//	sse.RateLimitFunc(func(r *http.Request) (*sse.RateLimiter, func()) {
+//		return set.Get(r.Header.Get("X-API-Key"))
+//	})
+type RateLimitFunc func(r *http.Request) (limiter *RateLimiter, release func())
+
+// requestOptions resolves the options which depend on the request.
+func requestOptions(r *http.Request, opts []any) ([]any, func()) {
+	out := make([]any, 0, len(opts))
+	release := func() {}
+	for _, opt := range opts {
+		fn, ok := opt.(RateLimitFunc)
+		if !ok {
+			out = append(out, opt)
+			continue
+		}
+		limiter, done := fn(r)
+		if limiter != nil {
+			out = append(out, limiter)
+		}
+		if done != nil {
+			release = done
+		}
+	}
+	return out, release
+}
+
+// isDataMessage reports whether the message carries event data,
+// which counts against the rate limit and carries the trace context.
+// Comments, errors and the close message are control messages.
+func isDataMessage(m *Message) bool {
+	return m.Event != EventError && m.Data != ""
+}
+
+// coalesce keeps the message as the latest pending one of its event.
+func (s *Sender) coalesce(m *Message) {
+	name := eventName(m.Event)
+	for i, p := range s.pending {
+		if eventName(p.Event) == name {
+			s.pending[i] = m
+			return
+		}
+	}
+	s.pending = append(s.pending, m)
+}
+
+// dropPending removes the pending message of the event, which is outdated by a newer one.
+func (s *Sender) dropPending(m *Message) {
+	name := eventName(m.Event)
+	for i, p := range s.pending {
+		if eventName(p.Event) == name {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Sender) schedulePending(d time.Duration) {
+	if s.IsClosed() || s.pendingTimer.Load() != nil {
+		return
+	}
+	s.pendingTimer.Store(time.AfterFunc(d, s.sendPending))
+}
+
+func (s *Sender) sendPending() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pendingTimer.Store(nil)
+	if s.IsClosed() {
+		s.pending = nil
+		return
+	}
+
+	for len(s.pending) > 0 {
+		if d := s.limiter.reserve(); d > 0 {
+			s.schedulePending(d)
+			break
+		}
+		m := s.pending[0]
+		s.pending = s.pending[1:]
+		if err := s.w.Write(m); err != nil {
+			s.close()
+			return
+		}
+	}
+	_ = s.w.Flush()
+}
@@ -18,6 +18,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"strings"
 )
@@ -26,28 +27,39 @@ type ReceiveDataEvent string
 
 func NewReceiver[T any](reader io.Reader, coverFn func(data []byte) (T, bool), opts ...any) *Receiver[T] {
 	if coverFn == nil {
-		coverFn = func(data []byte) (T, bool) {
-			var out T
-			err := json.Unmarshal(data, &out)
-			return out, err == nil
-		}
+		coverFn = receiveCoverFunc[T]
 	}
 
-	r := &Receiver[T]{
+	r := newReceiver[T](reader, nil, func(m *Message) (T, error) {
+		data, ok := coverFn([]byte(m.Data))
+		if !ok {
+			return data, errSkipMessage
+		}
+		return data, nil
+	})
+	r.setOptions(opts...)
+	return r
+}
+
+func receiveCoverFunc[T any](data []byte) (T, bool) {
+	var out T
+	err := json.Unmarshal(data, &out)
+	return out, err == nil
+}
+
+// errSkipMessage skips the message without reporting an error.
+var errSkipMessage = errors.New("skip message")
+
+func newReceiver[T any](reader io.Reader, match func(event string) bool, decodeFn func(m *Message) (T, error)) *Receiver[T] {
+	return &Receiver[T]{
 		dataCh:    make(chan T),
 		errCh:     make(chan error),
 		runCh:     make(chan struct{}),
 		parser:    NewParser(reader),
-		coverFn:   coverFn,
+		match:     match,
+		decodeFn:  decodeFn,
 		dataEvent: EventMessage,
 	}
-	for _, opt := range opts {
-		switch v := opt.(type) {
-		case ReceiveDataEvent:
-			r.dataEvent = string(v)
-		}
-	}
-	return r
 }
 
 type Receiver[T any] struct {
@@ -56,8 +68,48 @@ type Receiver[T any] struct {
 	runCh  chan struct{}
 
 	parser    *Parser
-	coverFn   func(data []byte) (T, bool)
+	match     func(event string) bool
+	decodeFn  func(m *Message) (T, error)
 	dataEvent string
+	trace     TracePropagation
+}
+
+func (r *Receiver[T]) setOptions(opts ...any) {
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case ReceiveDataEvent:
+			r.dataEvent = string(v)
+		case TracePropagation:
+			r.trace = v
+		case *Registry:
+			// Receive every event of the registry instead of the data event.
+			registry := v
+			r.match = registry.Has
+			r.decodeFn = func(m *Message) (T, error) {
+				var out T
+				value, err := registry.Decode(m)
+				if err != nil {
+					return out, err
+				}
+				out, ok := value.(T)
+				if !ok {
+					return out, &DecodeError{
+						Event: m.Event,
+						Data:  m.Data,
+						Err:   fmt.Errorf("cannot receive %T as %T", value, out),
+					}
+				}
+				return out, nil
+			}
+		}
+	}
+}
+
+func (r *Receiver[T]) matches(event string) bool {
+	if r.match != nil {
+		return r.match(event)
+	}
+	return event == r.dataEvent
 }
 
 func (r *Receiver[T]) IsClosed() bool {
@@ -100,14 +152,22 @@ func (r *Receiver[T]) Run(ctx context.Context) {
 			r.errCh <- errors.New(message.Data)
 			return nil
 		}
-		if message.Event != r.dataEvent {
+		if !r.matches(message.Event) {
 			return nil
 		}
+		if r.trace == TraceEnvelope {
+			unwrapTraceEnvelope(message)
+		}
 
-		data, ok := r.coverFn([]byte(message.Data))
-		if ok {
-			r.dataCh <- data
+		data, err := r.decodeFn(message)
+		if err == errSkipMessage {
+			return nil
+		}
+		if err != nil {
+			r.errCh <- err
+			return nil
 		}
+		r.dataCh <- data
 		return nil
 	})
 	if err != nil {
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -52,15 +54,117 @@ func NewSender(w http.ResponseWriter, opts ...any) (*Sender, error) {
 		}
 	}
 
-	return &Sender{
-		rw:      rw,
-		closeCh: make(chan struct{}),
-	}, nil
+	return newSender(&streamWriter{rw: rw}, opts...), nil
+}
+
+// StreamFunc produces the messages of a stream through the Sender,
+// so that the same producer can serve both the SSE and the websocket transport.
+type StreamFunc func(ctx context.Context, s *Sender) error
+
+// Handler serves the stream produced by fn as text/event-stream,
+// opts are passed to NewSender.
+func Handler(fn StreamFunc, opts ...any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		senderOpts, release := requestOptions(r, opts)
+		defer release()
+
+		s, err := NewSender(w, senderOpts...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := fn(r.Context(), s); err != nil {
+			s.SendError(err)
+		}
+		s.Close()
+	})
+}
+
+// messageWriter writes messages to the transport of a Sender.
+type messageWriter interface {
+	Write(m *Message) error
+	Flush() error
+}
+
+type streamWriter struct {
+	rw ResponseWriter
+}
+
+func (w *streamWriter) Write(m *Message) error {
+	msg := m.String()
+	if msg == "" {
+		return nil
+	}
+	_, err := io.WriteString(w.rw, msg)
+	return err
+}
+
+func (w *streamWriter) Flush() error {
+	w.rw.Flush()
+	return nil
+}
+
+func newSender(w messageWriter, opts ...any) *Sender {
+	s := &Sender{
+		w:         w,
+		closeCh:   make(chan struct{}),
+		closingCh: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case *RateLimiter:
+			s.limiter = v
+		case RatePolicy:
+			s.policy = v
+		case TracePropagation:
+			s.trace = v
+		}
+	}
+	return s
 }
 
 type Sender struct {
-	rw      ResponseWriter
-	closeCh chan struct{}
+	w         messageWriter
+	closeCh   chan struct{}
+	closeOnce sync.Once
+	recvCh    chan *Message
+
+	// closingCh is closed without the lock once the Sender is closing,
+	// which stops the senders waiting for the rate limit.
+	closingCh   chan struct{}
+	closingOnce sync.Once
+
+	mu           sync.Mutex
+	limiter      *RateLimiter
+	policy       RatePolicy
+	pending      []*Message
+	pendingTimer atomic.Pointer[time.Timer]
+	trace        TracePropagation
+}
+
+// Received returns the messages sent by the client, it must be drained by the websocket producers
+// which expect messages, see NewWebSocketSender.
+// Only the websocket transport receives messages, the channel of a SSE Sender is never ready.
+func (s *Sender) Received() <-chan *Message {
+	return s.recvCh
+}
+
+// close closes the Sender, the pending coalesced messages are dropped
+// unless they are delivered by the close message.
+func (s *Sender) close() {
+	s.closing()
+	s.closeOnce.Do(func() {
+		close(s.closeCh)
+	})
+	if t := s.pendingTimer.Swap(nil); t != nil {
+		t.Stop()
+	}
+}
+
+func (s *Sender) closing() {
+	s.closingOnce.Do(func() {
+		close(s.closingCh)
+	})
 }
 
 func (s *Sender) WaitForClose() <-chan struct{} {
@@ -77,6 +181,7 @@ func (s *Sender) IsClosed() bool {
 }
 
 func (s *Sender) Close() {
+	s.closing()
 	s.SendError(io.EOF)
 }
 
@@ -109,27 +214,66 @@ func (s *Sender) SendError(v any) {
 }
 
 func (s *Sender) Send(messages ...*Message) {
+	s.SendContext(context.Background(), messages...)
+}
+
+// SendContext sends the messages like Send,
+// the context bounds the time waiting for the rate limit and
+// carries the trace context injected by the TracePropagation option.
+func (s *Sender) SendContext(ctx context.Context, messages ...*Message) {
 	if s.IsClosed() {
 		return
 	}
 
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	for _, m := range messages {
 		if m == nil {
 			continue
 		}
 
-		msg := m.String()
-		if msg == "" {
-			continue
-		}
 		if m.IsClose() {
-			close(s.closeCh)
-			_, _ = io.WriteString(s.rw, msg)
+			// The latest pending messages are delivered before closing.
+			for _, p := range s.pending {
+				_ = s.w.Write(p)
+			}
+			s.pending = nil
+			s.close()
+			_ = s.w.Write(m)
 			break
 		}
-		_, _ = io.WriteString(s.rw, msg)
+		m = traceMessage(ctx, m, s.trace)
+		if s.limiter != nil && isDataMessage(m) {
+			if s.policy == RateCoalesce {
+				s.dropPending(m)
+			}
+			if d := s.limiter.reserve(); d > 0 {
+				switch s.policy {
+				case RateDrop:
+					continue
+				case RateCoalesce:
+					s.coalesce(m)
+					s.schedulePending(d)
+					continue
+				default:
+					// The lock is released while waiting, so that Close is not blocked by the limit.
+					s.mu.Unlock()
+					err := s.limiter.wait(ctx, s.closingCh)
+					s.mu.Lock()
+					if err != nil || s.IsClosed() {
+						_ = s.w.Flush()
+						return
+					}
+				}
+			}
+		}
+		if err := s.w.Write(m); err != nil {
+			// The client is gone, nothing more can be delivered.
+			s.close()
+			return
+		}
 	}
-	s.rw.Flush()
+	_ = s.w.Flush()
 }
 
 func SendLoop[T any](
@@ -196,7 +340,7 @@ L:
 			if err != nil {
 				s.SendError(err)
 			} else {
-				s.Send(msgs...)
+				s.SendContext(ctx, msgs...)
 			}
 			if !ok {
 				break L
@@ -214,7 +358,7 @@ L:
 						if coverErr != nil {
 							s.SendError(coverErr)
 						} else {
-							s.Send(msgs...)
+							s.SendContext(ctx, msgs...)
 						}
 						if !ok {
 							break L
@@ -35,6 +35,9 @@ const (
 	headerData  = "data:"
 	headerEvent = "event:"
 	headerRetry = "retry:"
+
+	headerTraceParent = "traceparent:"
+	headerTraceState  = "tracestate:"
 )
 
 const defaultBufferSize = 4096
@@ -47,6 +50,7 @@ type Message struct {
 	Event   string
 	Retry   time.Duration // ms
 	Comment string
+	Trace   TraceContext
 }
 
 func (m *Message) IsClose() bool {
@@ -76,6 +80,16 @@ func (m *Message) String() string {
 		sb.WriteString(strconv.FormatInt(m.Retry.Milliseconds(), 10))
 		sb.WriteString("\n")
 	}
+	if m.Trace.IsValid() {
+		sb.WriteString("traceparent: ")
+		sb.WriteString(m.Trace.TraceParent)
+		sb.WriteString("\n")
+		if m.Trace.TraceState != "" {
+			sb.WriteString("tracestate: ")
+			sb.WriteString(m.Trace.TraceState)
+			sb.WriteString("\n")
+		}
+	}
 	if m.Comment != "" {
 		sb.WriteString(": ")
 		sb.WriteString(m.Comment)
@@ -159,6 +173,10 @@ func processEventMsg(msg string) *Message {
 			v := trimPrefix(line, headerRetry)
 			d, _ := strconv.ParseInt(v, 10, 64)
 			message.Retry = time.Duration(d) * time.Millisecond
+		case strings.HasPrefix(line, headerTraceParent):
+			message.Trace.TraceParent = trimPrefix(line, headerTraceParent)
+		case strings.HasPrefix(line, headerTraceState):
+			message.Trace.TraceState = trimPrefix(line, headerTraceState)
 		default:
 		}
 	}
@@ -0,0 +1,190 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// TracePropagation is an option of the Sender and the Receiver
+// which decides how the W3C trace context is carried by the events.
+type TracePropagation int
+
+const (
+	// TraceNone does not inject the trace context.
+	TraceNone TracePropagation = iota
+	// TraceField carries the trace context in the traceparent and tracestate fields of the event,
+	// which are ignored by clients not aware of them.
+	TraceField
+	// TraceEnvelope carries the trace context in a json envelope of the data,
+	// e.g. {"traceparent":"00-...","data":{...}}, which survives proxies dropping unknown fields.
+	TraceEnvelope
+)
+
+// TraceContext is the W3C trace context of an event,
+// see https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	TraceParent string
+	TraceState  string
+}
+
+// IsValid reports whether the traceparent is well-formed,
+// the format is {version}-{trace-id}-{parent-id}-{trace-flags}.
+func (tc TraceContext) IsValid() bool {
+	parts := strings.Split(tc.TraceParent, "-")
+	if len(parts) < 4 {
+		return false
+	}
+	version, traceID, parentID, flags := parts[0], parts[1], parts[2], parts[3]
+	if !isLowerHex(version, 2) || version == "ff" {
+		return false
+	}
+	// Version 00 has exactly four parts, future versions may append more.
+	if version == "00" && len(parts) != 4 {
+		return false
+	}
+	if !isLowerHex(traceID, 32) || traceID == strings.Repeat("0", 32) {
+		return false
+	}
+	if !isLowerHex(parentID, 16) || parentID == strings.Repeat("0", 16) {
+		return false
+	}
+	return isLowerHex(flags, 2)
+}
+
+func isLowerHex(s string, size int) bool {
+	if len(s) != size {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a copy of ctx carrying the trace context,
+// the Sender injects it into the events sent with the context.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace context carried by ctx.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// Traced is a received value together with the trace context of its event.
+type Traced[T any] struct {
+	Value T
+	Trace TraceContext
+}
+
+// NewTracedReceiver returns a Receiver like NewReceiver,
+// which delivers every decoded value alongside the trace context of its event.
+func NewTracedReceiver[T any](reader io.Reader, coverFn func(data []byte) (T, bool), opts ...any) *Receiver[Traced[T]] {
+	if coverFn == nil {
+		coverFn = receiveCoverFunc[T]
+	}
+
+	r := newReceiver[Traced[T]](reader, nil, func(m *Message) (Traced[T], error) {
+		data, ok := coverFn([]byte(m.Data))
+		if !ok {
+			return Traced[T]{}, errSkipMessage
+		}
+		return Traced[T]{Value: data, Trace: m.Trace}, nil
+	})
+	r.setOptions(opts...)
+	return r
+}
+
+type traceEnvelope struct {
+	TraceParent string          `json:"traceparent"`
+	TraceState  string          `json:"tracestate,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+	Text        *string         `json:"text,omitempty"`
+}
+
+// traceMessage injects the trace context into the message according to the propagation,
+// the trace context of the message is dropped if it is not propagated or not valid.
+// The message is copied, so the caller can still reuse it.
+func traceMessage(ctx context.Context, m *Message, propagation TracePropagation) *Message {
+	if propagation == TraceNone || !isDataMessage(m) {
+		return withoutTrace(m)
+	}
+
+	tc := m.Trace
+	if tc.TraceParent == "" {
+		tc, _ = TraceFromContext(ctx)
+	}
+	if !tc.IsValid() {
+		return withoutTrace(m)
+	}
+
+	out := *m
+	out.Trace = tc
+	if propagation != TraceEnvelope {
+		return &out
+	}
+
+	envelope := &traceEnvelope{TraceParent: tc.TraceParent, TraceState: tc.TraceState}
+	if json.Valid([]byte(m.Data)) {
+		envelope.Data = json.RawMessage(m.Data)
+	} else {
+		envelope.Text = &m.Data
+	}
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return m
+	}
+	out.Data = string(data)
+	out.Trace = TraceContext{}
+	return &out
+}
+
+func withoutTrace(m *Message) *Message {
+	if m.Trace == (TraceContext{}) {
+		return m
+	}
+	out := *m
+	out.Trace = TraceContext{}
+	return &out
+}
+
+// unwrapTraceEnvelope restores the data and the trace context of a message
+// sent with TraceEnvelope, messages which are not an envelope are left as is.
+func unwrapTraceEnvelope(m *Message) {
+	var envelope traceEnvelope
+	if err := json.Unmarshal([]byte(m.Data), &envelope); err != nil {
+		return
+	}
+	if envelope.TraceParent == "" || (envelope.Data == nil && envelope.Text == nil) {
+		return
+	}
+
+	m.Trace = TraceContext{TraceParent: envelope.TraceParent, TraceState: envelope.TraceState}
+	if envelope.Text != nil {
+		m.Data = *envelope.Text
+	} else {
+		m.Data = string(envelope.Data)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright © 2024 zc2638 <zc2638@qq.com>.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketHandshake is an option of WebSocketHandler to validate the handshake,
+// e.g. to check the Origin header. By default, SameOriginHandshake is used.
+type WebSocketHandshake func(config *websocket.Config, r *http.Request) error
+
+// SameOriginHandshake accepts the handshakes whose Origin header has the same host as the request,
+// which keeps other sites from opening streams with the cookies of the user.
+// Handshakes without an Origin header are sent by non-browser clients and are accepted.
+func SameOriginHandshake(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil {
+		return err
+	}
+	config.Origin = origin
+	if origin != nil && !strings.EqualFold(origin.Host, r.Host) {
+		return fmt.Errorf("cross origin websocket request from %s", origin.Host)
+	}
+	return nil
+}
+
+// WebSocketMessage is the websocket codec of Message.
+// A message is transferred as a json object in a text frame,
+// frames which are not a json object are received as the data of a message event.
+var WebSocketMessage = websocket.Codec{
+	Marshal:   marshalWebSocketMessage,
+	Unmarshal: unmarshalWebSocketMessage,
+}
+
+type webSocketMessage struct {
+	ID      string `json:"id,omitempty"`
+	Event   string `json:"event,omitempty"`
+	Data    string `json:"data,omitempty"`
+	Retry   int64  `json:"retry,omitempty"`
+	Comment string `json:"comment,omitempty"`
+
+	TraceParent string `json:"traceparent,omitempty"`
+	TraceState  string `json:"tracestate,omitempty"`
+}
+
+func marshalWebSocketMessage(v any) ([]byte, byte, error) {
+	var m *Message
+	switch vv := v.(type) {
+	case *Message:
+		m = vv
+	case Message:
+		m = &vv
+	default:
+		return nil, 0, errors.New("websocket message must be a sse message")
+	}
+	if m == nil {
+		return nil, 0, errors.New("websocket message is nil")
+	}
+
+	data, err := json.Marshal(&webSocketMessage{
+		ID:      m.ID,
+		Event:   m.Event,
+		Data:    m.Data,
+		Retry:   m.Retry.Milliseconds(),
+		Comment: m.Comment,
+
+		TraceParent: m.Trace.TraceParent,
+		TraceState:  m.Trace.TraceState,
+	})
+	return data, websocket.TextFrame, err
+}
+
+func unmarshalWebSocketMessage(data []byte, _ byte, v any) error {
+	m, ok := v.(*Message)
+	if !ok || m == nil {
+		return errors.New("websocket message must be unmarshalled into a sse message")
+	}
+
+	var wm webSocketMessage
+	if err := json.Unmarshal(data, &wm); err != nil {
+		*m = Message{Event: EventMessage, Data: string(data)}
+		return nil
+	}
+	*m = Message{
+		ID:      wm.ID,
+		Event:   wm.Event,
+		Data:    wm.Data,
+		Retry:   time.Duration(wm.Retry) * time.Millisecond,
+		Comment: wm.Comment,
+		Trace:   TraceContext{TraceParent: wm.TraceParent, TraceState: wm.TraceState},
+	}
+	return nil
+}
+
+type webSocketWriter struct {
+	ws *websocket.Conn
+}
+
+func (w *webSocketWriter) Write(m *Message) error {
+	if m.String() == "" {
+		return nil
+	}
+	return WebSocketMessage.Send(w.ws, m)
+}
+
+func (w *webSocketWriter) Flush() error {
+	return nil
+}
+
+// WebSocketReceiveBuffer is the number of client messages buffered for Sender.Received.
+const WebSocketReceiveBuffer = 16
+
+// NewWebSocketSender returns a Sender which writes messages to the websocket connection.
+// The messages sent by the client are delivered by Sender.Received, which must be drained,
+// the messages arriving while WebSocketReceiveBuffer messages are waiting are dropped.
+// The Sender and the received channel are closed when the client goes away.
+func NewWebSocketSender(ws *websocket.Conn, opts ...any) *Sender {
+	s := newSender(&webSocketWriter{ws: ws}, opts...)
+	s.recvCh = make(chan *Message, WebSocketReceiveBuffer)
+	go s.receiveWebSocket(ws)
+	return s
+}
+
+func (s *Sender) receiveWebSocket(ws *websocket.Conn) {
+	defer close(s.recvCh)
+	defer s.close()
+
+	for {
+		m := new(Message)
+		if err := WebSocketMessage.Receive(ws, m); err != nil {
+			return
+		}
+		if m.IsClose() {
+			return
+		}
+
+		// The connection keeps being read even if nobody receives,
+		// so that the client going away is noticed.
+		select {
+		case <-s.closeCh:
+			return
+		case s.recvCh <- m:
+		default:
+		}
+	}
+}
+
+// WebSocketHandler serves the stream produced by fn over websocket,
+// which is the bidirectional counterpart of Handler, opts are passed to NewWebSocketSender.
+func WebSocketHandler(fn StreamFunc, opts ...any) http.Handler {
+	srv := websocket.Server{
+		Handshake: SameOriginHandshake,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+
+			ctx, cancel := context.WithCancel(ws.Request().Context())
+			defer cancel()
+
+			senderOpts, release := requestOptions(ws.Request(), opts)
+			defer release()
+
+			s := NewWebSocketSender(ws, senderOpts...)
+			go func() {
+				select {
+				case <-ctx.Done():
+				case <-s.WaitForClose():
+					cancel()
+				}
+			}()
+
+			if err := fn(ctx, s); err != nil {
+				s.SendError(err)
+			}
+			s.Close()
+		},
+	}
+	for _, opt := range opts {
+		switch v := opt.(type) {
+		case WebSocketHandshake:
+			srv.Handshake = v
+		}
+	}
+	return srv
+}